@@ -0,0 +1,358 @@
+// Copyright © 2015 Clement 'cmc' Rey <cr.rey.clement@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package freetree
+
+import (
+	"fmt"
+	"math/rand"
+)
+
+// -----------------------------------------------------------------------------
+
+// Balancing defines the strategy used by a SimpleTree to keep itself
+// balanced as elements are inserted.
+type Balancing int
+
+const (
+	// NoBalancing never rebalances the tree on its own: inserting unsorted
+	// data makes it degenerate, until Rebalance() is called.
+	// This is the default strategy.
+	NoBalancing Balancing = iota
+	// AVLBalancing keeps the heights of the two subtrees of every node within
+	// one of each other.
+	// It makes for the shortest trees, at the cost of more rotations.
+	AVLBalancing
+	// RedBlackBalancing keeps the tree as a left-leaning red-black tree: a
+	// tree is at most twice as high as a perfectly balanced one.
+	RedBlackBalancing
+	// TreapBalancing assigns a random priority to every node and keeps the
+	// tree heap-ordered on those priorities: the tree is balanced with high
+	// probability, whatever the order of the insertions.
+	TreapBalancing
+)
+
+// String returns the name of the balancing strategy.
+func (b Balancing) String() string {
+	switch b {
+	case NoBalancing:
+		return "NoBalancing"
+	case AVLBalancing:
+		return "AVLBalancing"
+	case RedBlackBalancing:
+		return "RedBlackBalancing"
+	case TreapBalancing:
+		return "TreapBalancing"
+	}
+	return fmt.Sprintf("Balancing(%d)", int(b))
+}
+
+// -----------------------------------------------------------------------------
+
+// The functions below are recursive, unlike their NoBalancing counterparts
+// in simpletree.go: the trees they operate on are balanced, so their depth is
+// bounded by O(log(n)).
+
+// red is the color of the red nodes in a red-black tree; black nodes are 0.
+const red = 1
+
+// insertAVL inserts `c` in the subtree and rebalances it AVL-style; it
+// returns the new root of the subtree.
+//
+// `meta` holds the height of the subtree rooted at the node.
+func (sn *simpleNode) insertAVL(c Comparable, id uint) *simpleNode {
+	if sn == nil {
+		return &simpleNode{id: id, data: c, meta: 1}
+	}
+
+	if c.Less(sn.data) {
+		sn.left = sn.left.insertAVL(c, id)
+	} else {
+		sn.right = sn.right.insertAVL(c, id)
+	}
+
+	return sn.balanceAVL()
+}
+
+// height returns the height of an AVL subtree.
+func (sn *simpleNode) height() uint32 {
+	if sn == nil {
+		return 0
+	}
+	return sn.meta
+}
+
+// updateHeight recomputes the height of an AVL node from its children's.
+func (sn *simpleNode) updateHeight() {
+	sn.meta = 1 + sn.left.height()
+	if h := 1 + sn.right.height(); h > sn.meta {
+		sn.meta = h
+	}
+}
+
+// balanceAVL updates the height of the node and, if its subtrees' heights
+// differ by more than one, rotates it; it returns the new root of the
+// subtree.
+func (sn *simpleNode) balanceAVL() *simpleNode {
+	sn.updateHeight()
+
+	left, right := sn.left.height(), sn.right.height()
+	var root *simpleNode
+	switch {
+	case left > right+1:
+		if sn.left.left.height() < sn.left.right.height() {
+			sn.left = sn.left.rotateLeft()
+			sn.left.left.updateHeight()
+			sn.left.updateHeight()
+		}
+		root = sn.rotateRight()
+	case right > left+1:
+		if sn.right.right.height() < sn.right.left.height() {
+			sn.right = sn.right.rotateRight()
+			sn.right.right.updateHeight()
+			sn.right.updateHeight()
+		}
+		root = sn.rotateLeft()
+	default:
+		return sn
+	}
+	sn.updateHeight()
+	root.updateHeight()
+
+	return root
+}
+
+// insertRedBlack inserts `c` in the subtree and rebalances it as a
+// left-leaning red-black tree; it returns the new root of the subtree.
+//
+// `meta` holds the color of the node.
+func (sn *simpleNode) insertRedBlack(c Comparable, id uint) *simpleNode {
+	if sn == nil {
+		return &simpleNode{id: id, data: c, meta: red}
+	}
+
+	if c.Less(sn.data) {
+		sn.left = sn.left.insertRedBlack(c, id)
+	} else {
+		sn.right = sn.right.insertRedBlack(c, id)
+	}
+
+	return sn.fixUpRedBlack()
+}
+
+// isRed returns true if the node is a red node of a red-black tree.
+func (sn *simpleNode) isRed() bool {
+	return sn != nil && sn.meta == red
+}
+
+// rotateLeftRedBlack rotates the node left, preserving the colors of the
+// red-black tree; it returns the new root of the subtree.
+func (sn *simpleNode) rotateLeftRedBlack() *simpleNode {
+	r := sn.rotateLeft()
+	r.meta, sn.meta = sn.meta, red
+	return r
+}
+
+// rotateRightRedBlack rotates the node right, preserving the colors of the
+// red-black tree; it returns the new root of the subtree.
+func (sn *simpleNode) rotateRightRedBlack() *simpleNode {
+	l := sn.rotateRight()
+	l.meta, sn.meta = sn.meta, red
+	return l
+}
+
+// flipColors flips the colors of the node and its children.
+func (sn *simpleNode) flipColors() {
+	sn.meta ^= red
+	sn.left.meta ^= red
+	sn.right.meta ^= red
+}
+
+// fixUpRedBlack restores the left-leaning red-black invariants on the way up
+// from an insertion or a removal; it returns the new root of the subtree.
+func (sn *simpleNode) fixUpRedBlack() *simpleNode {
+	if sn.right.isRed() && !sn.left.isRed() {
+		sn = sn.rotateLeftRedBlack()
+	}
+	if sn.left.isRed() && sn.left.left.isRed() {
+		sn = sn.rotateRightRedBlack()
+	}
+	if sn.left.isRed() && sn.right.isRed() {
+		sn.flipColors()
+	}
+
+	return sn
+}
+
+// removeRedBlack removes the first element of the subtree that is == `c`,
+// which must exist, and rebalances the tree as a left-leaning red-black tree;
+// it returns the new root of the tree.
+//
+// It must be called on the root of the tree.
+func (sn *simpleNode) removeRedBlack(c Comparable) *simpleNode {
+	if !sn.left.isRed() && !sn.right.isRed() {
+		sn.meta = red
+	}
+	if sn = sn.deleteRedBlack(c); sn != nil {
+		sn.meta = 0
+	}
+
+	return sn
+}
+
+// deleteRedBlack is the recursive part of removeRedBlack(): red links are
+// pushed down the search path so that the removed node is never a black
+// leaf.
+func (sn *simpleNode) deleteRedBlack(c Comparable) *simpleNode {
+	if c.Less(sn.data) {
+		if !sn.left.isRed() && !sn.left.left.isRed() {
+			sn = sn.moveRedLeft()
+		}
+		sn.left = sn.left.deleteRedBlack(c)
+	} else {
+		// rotations might bring up another element == `c`: the node to
+		// remove is tracked by identity so that the search path stays the
+		// same as if all elements were distinct
+		var target *simpleNode
+		if !sn.data.Less(c) {
+			target = sn
+		}
+		if sn.left.isRed() {
+			sn = sn.rotateRightRedBlack()
+		}
+		if sn == target && sn.right == nil {
+			return nil
+		}
+		if !sn.right.isRed() && !sn.right.left.isRed() {
+			sn = sn.moveRedRight()
+		}
+		if sn == target {
+			// the successor's data takes the place of the removed data
+			var min *simpleNode
+			sn.right, min = sn.right.deleteMinRedBlack()
+			sn.data = min.data
+		} else {
+			sn.right = sn.right.deleteRedBlack(c)
+		}
+	}
+
+	return sn.fixUpRedBlack()
+}
+
+// deleteMinRedBlack unlinks the node holding the smallest element of the
+// subtree, and returns the new root of the subtree along with the unlinked
+// node.
+func (sn *simpleNode) deleteMinRedBlack() (root, min *simpleNode) {
+	if sn.left == nil {
+		return nil, sn
+	}
+	if !sn.left.isRed() && !sn.left.left.isRed() {
+		sn = sn.moveRedLeft()
+	}
+	sn.left, min = sn.left.deleteMinRedBlack()
+
+	return sn.fixUpRedBlack(), min
+}
+
+// moveRedLeft makes the left child of the node, or one of its children, red.
+func (sn *simpleNode) moveRedLeft() *simpleNode {
+	sn.flipColors()
+	if sn.right.left.isRed() {
+		sn.right = sn.right.rotateRightRedBlack()
+		sn = sn.rotateLeftRedBlack()
+		sn.flipColors()
+	}
+	return sn
+}
+
+// moveRedRight makes the right child of the node, or one of its children,
+// red.
+func (sn *simpleNode) moveRedRight() *simpleNode {
+	sn.flipColors()
+	if sn.left.left.isRed() {
+		sn = sn.rotateRightRedBlack()
+		sn.flipColors()
+	}
+	return sn
+}
+
+// insertTreap inserts `c` in the subtree, with a random priority, and
+// rotates it up until the subtree is heap-ordered again; it returns the new
+// root of the subtree.
+//
+// `meta` holds the priority of the node.
+func (sn *simpleNode) insertTreap(c Comparable, id uint) *simpleNode {
+	if sn == nil {
+		return &simpleNode{id: id, data: c, meta: rand.Uint32()}
+	}
+
+	if c.Less(sn.data) {
+		sn.left = sn.left.insertTreap(c, id)
+		if sn.left.meta > sn.meta {
+			sn = sn.rotateRight()
+		}
+	} else {
+		sn.right = sn.right.insertTreap(c, id)
+		if sn.right.meta > sn.meta {
+			sn = sn.rotateLeft()
+		}
+	}
+
+	return sn
+}
+
+// removeTreap removes the first element of the subtree that is == `c`; it
+// returns the new root of the subtree along with whether an element was
+// removed.
+func (sn *simpleNode) removeTreap(c Comparable) (*simpleNode, bool) {
+	if sn == nil {
+		return nil, false
+	}
+
+	var removed bool
+	if c.Less(sn.data) {
+		sn.left, removed = sn.left.removeTreap(c)
+	} else if sn.data.Less(c) {
+		sn.right, removed = sn.right.removeTreap(c)
+	} else {
+		return joinTreaps(sn.left, sn.right), true
+	}
+
+	return sn, removed
+}
+
+// joinTreaps merges two heap-ordered subtrees, all the elements of `left`
+// being <= those of `right`, and returns the root of the merged subtree.
+func joinTreaps(left, right *simpleNode) *simpleNode {
+	if left == nil {
+		return right
+	}
+	if right == nil {
+		return left
+	}
+
+	if left.meta > right.meta {
+		left.right = joinTreaps(left.right, right)
+		return left
+	}
+	right.left = joinTreaps(left, right.left)
+	return right
+}
+
+// rotateLeft makes the right child of the node the new root of the subtree,
+// and returns it.
+func (sn *simpleNode) rotateLeft() *simpleNode {
+	r := sn.right
+	sn.right, r.left = r.left, sn
+	return r
+}
+
+// rotateRight makes the left child of the node the new root of the subtree,
+// and returns it.
+func (sn *simpleNode) rotateRight() *simpleNode {
+	l := sn.left
+	sn.left, l.right = l.right, sn
+	return l
+}
@@ -0,0 +1,116 @@
+// Copyright © 2015 Clement 'cmc' Rey <cr.rey.clement@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package freetree
+
+import (
+	"math/rand"
+	"testing"
+)
+
+// -----------------------------------------------------------------------------
+
+// depth returns the height of the subtree.
+func (sn *simpleNode) depth() int {
+	if sn == nil {
+		return 0
+	}
+	left, right := sn.left.depth(), sn.right.depth()
+	if left > right {
+		return left + 1
+	}
+	return right + 1
+}
+
+// checkInvariants checks the invariants of the balancing strategy on the
+// subtree; it returns the subtree's black height for red-black trees.
+func checkInvariants(t *testing.T, sn *simpleNode, balancing Balancing) int {
+	if sn == nil {
+		return 0
+	}
+
+	left := checkInvariants(t, sn.left, balancing)
+	right := checkInvariants(t, sn.right, balancing)
+	switch balancing {
+	case AVLBalancing:
+		if sn.meta != uint32(sn.depth()) {
+			t.Fatalf("%v: node %d: wrong height", balancing, sn.id)
+		}
+		if d := sn.left.depth() - sn.right.depth(); d < -1 || d > 1 {
+			t.Fatalf("%v: node %d: unbalanced", balancing, sn.id)
+		}
+	case RedBlackBalancing:
+		if sn.right.isRed() || (sn.isRed() && sn.left.isRed()) {
+			t.Fatalf("%v: node %d: misplaced red link", balancing, sn.id)
+		}
+		if left != right {
+			t.Fatalf("%v: node %d: unbalanced", balancing, sn.id)
+		}
+		if !sn.isRed() {
+			left++
+		}
+	case TreapBalancing:
+		if (sn.left != nil && sn.left.meta > sn.meta) ||
+			(sn.right != nil && sn.right.meta > sn.meta) {
+			t.Fatalf("%v: node %d: not heap-ordered", balancing, sn.id)
+		}
+	}
+
+	return left
+}
+
+func TestSimpleTree_balancing(t *testing.T) {
+	const n = 10000
+	maxDepth := map[Balancing]int{
+		AVLBalancing:      20, // ~1.44 * log2(n)
+		RedBlackBalancing: 28, // 2 * log2(n)
+		TreapBalancing:    50, // with high probability
+	}
+
+	for balancing, max := range maxDepth {
+		for _, shuffle := range []bool{false, true} {
+			ca := make(ComparableArray, n)
+			for i := range ca {
+				ca[i] = intTest(i)
+			}
+			if shuffle {
+				rand.Shuffle(n, func(i, j int) { ca[i], ca[j] = ca[j], ca[i] })
+			}
+
+			st := NewBalancedSimpleTree(balancing)
+			for _, c := range ca {
+				st.Insert(c)
+			}
+			checkInvariants(t, st.root, balancing)
+			if d := st.root.depth(); d > max {
+				t.Errorf("%v: unexpected depth: %d", balancing, d)
+			}
+			if st.Rebalance(); st.root.depth() > max {
+				t.Errorf("%v: unexpected depth after Rebalance", balancing)
+			}
+
+			ft, err := NewFreeTree(st)
+			if err != nil {
+				t.Fatal(err)
+			}
+			flat := ft.FlattenOrder(InOrder)
+			ft.Delete()
+			for i, c := range flat {
+				if c != intTest(i) {
+					t.Fatalf("%v: unexpected retval at index %d: %v", balancing, i, c)
+				}
+			}
+		}
+	}
+}
+
+func TestNewBalancedSimpleTree_unknown_strategy(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("expected panic")
+		}
+	}()
+	NewBalancedSimpleTree(Balancing(42))
+}
@@ -0,0 +1,253 @@
+// Copyright © 2015 Clement 'cmc' Rey <cr.rey.clement@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package freetree
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/teh-cmc/mmm"
+)
+
+// -----------------------------------------------------------------------------
+
+// cacheLineSize is the size of the nodes of a FreeBTree, in bytes.
+const cacheLineSize = 64
+
+// FreeBTree implements a static B+tree with zero GC overhead.
+//
+// Elements are stored sorted, in a single data chunk which makes up the
+// leaves of the tree; internal nodes are stored in a separate index chunk.
+// Every node (leaf or internal) holds as many elements as fit in a cache
+// line, so that a lookup only takes one cache miss per level, instead of one
+// per element compared as with a FreeTree.
+// Nodes don't store links to their children: the children of the k-th node
+// of a level are the (k*(B+1))-th to (k*(B+1)+B)-th nodes of the level below,
+// B being the number of elements per node.
+type FreeBTree struct {
+	dataChunk  chunk
+	indexChunk chunk
+	levels     []btreeLevel // from the leaves up to the root
+	b          int
+}
+
+// btreeLevel describes a level of a FreeBTree.
+type btreeLevel struct {
+	nodes  int // number of nodes in the level
+	offset int // index of the level's first node in the index chunk
+}
+
+// NewFreeBTree returns a new FreeBTree using the data from a supplied
+// SimpleTree.
+func NewFreeBTree(st *SimpleTree) (*FreeBTree, error) {
+	return NewFreeBTreeFromSorted(st.FlattenOrder(InOrder))
+}
+
+// NewFreeBTreeFromSorted returns a new FreeBTree using the data from `ca`,
+// which must be sorted in increasing order.
+func NewFreeBTreeFromSorted(ca ComparableArray) (*FreeBTree, error) {
+	if len(ca) == 0 {
+		return &FreeBTree{}, nil
+	}
+	if err := ValidateComparable(ca[0]); err != nil {
+		return nil, err
+	}
+	typ := reflect.TypeOf(ca[0])
+	for i := 1; i < len(ca); i++ {
+		if reflect.TypeOf(ca[i]) != typ {
+			return nil, fmt.Errorf("freetree: cannot mix elements of type %v and %T", typ, ca[i])
+		}
+		if ca[i].Less(ca[i-1]) {
+			return nil, ErrNotSorted
+		}
+	}
+
+	n := len(ca)
+	dataChunk, err := mmm.NewMemChunk(ca[0], uint(n))
+	if err != nil {
+		return nil, err
+	}
+	for i, c := range ca {
+		dataChunk.Write(i, c)
+	}
+
+	bt := &FreeBTree{dataChunk: newChunk(dataChunk, ca[0], n)}
+	bt.b = cacheLineSize / int(bt.dataChunk.size)
+	if bt.b < 2 {
+		bt.b = 2
+	}
+
+	// count the nodes of each level, from the leaves up to the root, then
+	// lay the internal levels out from the root down
+	bt.levels = []btreeLevel{{nodes: (n + bt.b - 1) / bt.b}}
+	for bt.levels[len(bt.levels)-1].nodes > 1 {
+		below := bt.levels[len(bt.levels)-1].nodes
+		bt.levels = append(bt.levels, btreeLevel{nodes: (below + bt.b) / (bt.b + 1)})
+	}
+	nbIndexNodes := 0
+	for h := len(bt.levels) - 1; h > 0; h-- {
+		bt.levels[h].offset = nbIndexNodes
+		nbIndexNodes += bt.levels[h].nodes
+	}
+	if nbIndexNodes == 0 {
+		return bt, nil
+	}
+
+	indexChunk, err := mmm.NewMemChunk(ca[0], uint(nbIndexNodes*bt.b))
+	if err != nil {
+		bt.dataChunk.Delete()
+		return nil, err
+	}
+	bt.indexChunk = newChunk(indexChunk, ca[0], nbIndexNodes*bt.b)
+
+	// the i-th key of an internal node is the smallest element in the subtree
+	// of its (i+1)-th child, i.e. the first element of that subtree's
+	// leftmost leaf
+	leavesPerNode := 1
+	for h := 1; h < len(bt.levels); h++ {
+		level := bt.levels[h]
+		for k := 0; k < level.nodes; k++ {
+			for i, valid := 0, bt.keys(h, k); i < valid; i++ {
+				child := k*(bt.b+1) + i + 1
+				indexChunk.Write((level.offset+k)*bt.b+i, ca[child*leavesPerNode*bt.b])
+			}
+		}
+		leavesPerNode *= bt.b + 1
+	}
+
+	return bt, nil
+}
+
+// keys returns the number of valid keys in the k-th node of the h-th level,
+// h > 0; i.e. the number of children of that node minus one.
+func (bt FreeBTree) keys(h, k int) int {
+	keys := bt.levels[h-1].nodes - k*(bt.b+1) - 1
+	if keys > bt.b {
+		return bt.b
+	}
+	return keys
+}
+
+// lowerBound returns the index of the smallest element that is >= `pivot`,
+// or Len() if there is none.
+func (bt FreeBTree) lowerBound(pivot Comparable) int {
+	k := 0
+	for h := len(bt.levels) - 1; h > 0; h-- {
+		offset, valid := (bt.levels[h].offset+k)*bt.b, bt.keys(h, k)
+		i := 0
+		for i < valid && bt.indexChunk.View(offset+i).Less(pivot) {
+			i++
+		}
+		k = k*(bt.b+1) + i
+	}
+
+	// if every element of the leaf is < pivot, then the answer is the first
+	// element of the next leaf, which directly follows in the data chunk
+	i, end := k*bt.b, (k+1)*bt.b
+	if end > bt.dataChunk.len {
+		end = bt.dataChunk.len
+	}
+	for i < end && bt.dataChunk.View(i).Less(pivot) {
+		i++
+	}
+
+	return i
+}
+
+// data returns a copy of the i-th smallest element of the tree.
+func (bt FreeBTree) data(i int) Comparable {
+	return bt.dataChunk.Read(i).(Comparable)
+}
+
+// Len returns the number of elements in the tree.
+func (bt FreeBTree) Len() int {
+	return bt.dataChunk.len
+}
+
+// Ascend returns the first element in the tree that is == `pivot`.
+func (bt FreeBTree) Ascend(pivot Comparable) Comparable {
+	if i := bt.lowerBound(pivot); i < bt.Len() && !pivot.Less(bt.dataChunk.View(i)) {
+		return bt.data(i)
+	}
+	return nil
+}
+
+// Contains returns true if the tree holds an element that is == `pivot`.
+//
+// Contrary to Ascend(), it never allocates.
+func (bt FreeBTree) Contains(pivot Comparable) bool {
+	i := bt.lowerBound(pivot)
+	return i < bt.Len() && !pivot.Less(bt.dataChunk.View(i))
+}
+
+// Select returns the k-th smallest element in the tree (starting at 0), or
+// nil if `k` is out of bounds.
+func (bt FreeBTree) Select(k int) Comparable {
+	if k < 0 || k >= bt.Len() {
+		return nil
+	}
+	return bt.data(k)
+}
+
+// Rank returns the number of elements in the tree that are < `pivot`.
+func (bt FreeBTree) Rank(pivot Comparable) int {
+	return bt.lowerBound(pivot)
+}
+
+// AscendRange calls `visitor` on every element `e` of the tree such that
+// `greaterOrEqual` <= `e` < `lessThan`, in increasing order.
+// Iteration stops as soon as `visitor` returns false.
+func (bt FreeBTree) AscendRange(greaterOrEqual, lessThan Comparable, visitor Visitor) {
+	bt.ascendRange(bt.lowerBound(greaterOrEqual), lessThan, visitor)
+}
+
+// AscendGreaterOrEqual calls `visitor` on every element `e` of the tree such
+// that `e` >= `pivot`, in increasing order.
+// Iteration stops as soon as `visitor` returns false.
+func (bt FreeBTree) AscendGreaterOrEqual(pivot Comparable, visitor Visitor) {
+	bt.ascendRange(bt.lowerBound(pivot), nil, visitor)
+}
+
+// ascendRange visits the elements from index `i` onwards, as long as they
+// are < `hi`; a nil bound means unbounded.
+func (bt FreeBTree) ascendRange(i int, hi Comparable, visitor Visitor) {
+	for ; i < bt.Len(); i++ {
+		if (hi != nil && !bt.dataChunk.View(i).Less(hi)) || !visitor(bt.data(i)) {
+			return
+		}
+	}
+}
+
+// DescendLessThan calls `visitor` on every element `e` of the tree such that
+// `e` < `pivot`, in decreasing order.
+// Iteration stops as soon as `visitor` returns false.
+func (bt FreeBTree) DescendLessThan(pivot Comparable, visitor Visitor) {
+	for i := bt.lowerBound(pivot) - 1; i >= 0; i-- {
+		if !visitor(bt.data(i)) {
+			return
+		}
+	}
+}
+
+// Flatten returns the content of the tree as a ComparableArray, in
+// increasing order.
+func (bt FreeBTree) Flatten() ComparableArray {
+	ca := make(ComparableArray, 0, bt.Len())
+	bt.ascendRange(0, nil, func(c Comparable) bool {
+		ca = append(ca, c)
+		return true
+	})
+	return ca
+}
+
+// Delete deletes the memory chunks associated with the tree.
+func (bt *FreeBTree) Delete() *FreeBTree {
+	bt.indexChunk.Delete()
+	bt.dataChunk.Delete()
+	bt.levels = nil
+
+	return nil
+}
@@ -0,0 +1,155 @@
+// Copyright © 2015 Clement 'cmc' Rey <cr.rey.clement@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package freetree
+
+import "testing"
+
+// -----------------------------------------------------------------------------
+
+func TestFreeBTree(t *testing.T) {
+	// intTests are 8 bytes long: 8 of them per node, i.e. 4 levels for 1000
+	// elements
+	for _, n := range []int{1, 2, 7, 8, 9, 63, 64, 65, 71, 72, 73, 577, 1000} {
+		// even integers only, so that we can look for missing odd ones
+		ca := make(ComparableArray, n)
+		for i := range ca {
+			ca[i] = intTest(2 * i)
+		}
+		bt, err := NewFreeBTreeFromSorted(ca)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if bt.Len() != n {
+			t.Errorf("n=%d: unexpected length", n)
+		}
+		checkArray(t, "Flatten", ca, bt.Flatten())
+		for i := -1; i <= 2*n; i++ {
+			var expected Comparable
+			if i >= 0 && i%2 == 0 && i < 2*n {
+				expected = intTest(i)
+			}
+			if c := bt.Ascend(intTest(i)); c != expected {
+				t.Errorf("n=%d: Ascend(%d): expected %v, got %v", n, i, expected, c)
+			}
+			if r := bt.Rank(intTest(i)); r != (i+1)/2 && !(i < 0 && r == 0) {
+				t.Errorf("n=%d: Rank(%d): unexpected retval %d", n, i, r)
+			}
+		}
+
+		var visited ComparableArray
+		bt.AscendRange(intTest(3), intTest(9), collect(&visited, -1))
+		lo, hi := 2, 5
+		if lo > n {
+			lo = n
+		}
+		if hi > n {
+			hi = n
+		}
+		checkArray(t, "AscendRange", ca[lo:hi], visited)
+		visited = nil
+		bt.AscendGreaterOrEqual(intTest(2*n-2), collect(&visited, -1))
+		checkArray(t, "AscendGreaterOrEqual", ca[n-1:], visited)
+		visited = nil
+		bt.DescendLessThan(intTest(5), collect(&visited, 2))
+		if n >= 3 {
+			checkArray(t, "DescendLessThan", ComparableArray{intTest(4), intTest(2)}, visited)
+		}
+
+		bt.Delete()
+	}
+}
+
+func TestFreeBTree_from_SimpleTree(t *testing.T) {
+	st := NewSimpleTree()
+	cs := ComparableArray{intTest(5), intTest(4), intTest(6), intTest(1), intTest(3), intTest(2)}
+
+	st.InsertArray(cs)
+
+	bt, err := NewFreeBTree(st)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bt.Delete()
+
+	checkArray(t, "Flatten", st.FlattenOrder(InOrder), bt.Flatten())
+	if bt.Select(0) != intTest(1) || bt.Select(5) != intTest(6) || bt.Select(6) != nil {
+		t.Error("unexpected retval")
+	}
+}
+
+func TestFreeBTree_invalid_input(t *testing.T) {
+	for name, ca := range map[string]ComparableArray{
+		"unsorted": {intTest(2), intTest(1)},
+		"pointers": {pointerTest{}},
+		"mixed":    {numTest(1), numTest(2), wordTest("three")},
+	} {
+		if _, err := NewFreeBTreeFromSorted(ca); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func TestFreeBTree_empty(t *testing.T) {
+	bt, err := NewFreeBTree(NewSimpleTree())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bt.Delete()
+
+	visited := 0
+	visit := func(Comparable) bool { visited++; return true }
+	bt.AscendRange(nil, nil, visit)
+	bt.AscendGreaterOrEqual(intTest(1), visit)
+	bt.DescendLessThan(intTest(1), visit)
+	if bt.Len() != 0 || bt.Ascend(intTest(1)) != nil || bt.Select(0) != nil ||
+		bt.Rank(intTest(1)) != 0 || len(bt.Flatten()) != 0 || visited != 0 {
+		t.Error("unexpected retval")
+	}
+}
+
+func TestFreeBTree_lookup_allocs(t *testing.T) {
+	ca := make(ComparableArray, 1000)
+	for i := range ca {
+		ca[i] = intTest(i * 3)
+	}
+	bt, err := NewFreeBTreeFromSorted(ca)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bt.Delete()
+
+	pivots := ComparableArray{intTest(0), intTest(300), intTest(301), intTest(5000)}
+	allocs := testing.AllocsPerRun(100, func() {
+		for _, pivot := range pivots {
+			bt.Contains(pivot)
+			bt.Rank(pivot)
+		}
+	})
+	if allocs != 0 {
+		t.Errorf("unexpected allocations: %v", allocs)
+	}
+	if !bt.Contains(intTest(300)) || bt.Contains(intTest(301)) {
+		t.Error("unexpected retval")
+	}
+}
+
+// -----------------------------------------------------------------------------
+
+func BenchmarkFreeBTree_Ascend_10M(b *testing.B) {
+	const n = 10 * 1e6
+	ca := make(ComparableArray, n)
+	for i := range ca {
+		ca[i] = intTest(i)
+	}
+	bt, err := NewFreeBTreeFromSorted(ca)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer bt.Delete()
+
+	benchmarkAscend(b, bt, n)
+}
@@ -0,0 +1,222 @@
+// Copyright © 2015 Clement 'cmc' Rey <cr.rey.clement@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package freetree
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+
+	"github.com/teh-cmc/mmm"
+)
+
+// -----------------------------------------------------------------------------
+
+var (
+	// ErrNotSorted is returned when elements are not supplied in increasing
+	// order.
+	ErrNotSorted = errors.New("freetree: elements are not sorted")
+	// ErrBuilderDone is returned when using a FreeTreeBuilder after it has
+	// been built or deleted.
+	ErrBuilderDone = errors.New("freetree: builder has already been used")
+)
+
+// -----------------------------------------------------------------------------
+
+// NewFreeTreeFromSorted returns a new FreeTree using the data from `ca`,
+// which must be sorted in increasing order.
+//
+// Unlike NewFreeTree, it doesn't need an intermediate SimpleTree: data is
+// written straight into the tree's memory chunks, hence peak heap usage stays
+// proportional to `ca` rather than to the number of nodes.
+// The resulting tree is perfectly balanced, and has the exact same shape as
+// a SimpleTree built from `ca` with a single InsertArray() call.
+func NewFreeTreeFromSorted(ca ComparableArray) (*FreeTree, error) {
+	b := NewFreeTreeBuilder(len(ca))
+	for i, c := range ca {
+		if i > 0 && c.Less(ca[i-1]) {
+			b.Delete()
+			return nil, ErrNotSorted
+		}
+		if err := b.Add(c); err != nil {
+			b.Delete()
+			return nil, err
+		}
+	}
+
+	return b.Build()
+}
+
+// -----------------------------------------------------------------------------
+
+// FreeTreeBuilder builds a FreeTree from a stream of elements, writing them
+// straight into off-heap memory as they come.
+//
+// The builder's data chunk grows as needed, so that the amount of GC-visible
+// memory used stays constant no matter how many elements are added.
+// Elements don't need to be sorted, although pre-sorted input saves a sort
+// pass when Build is called.
+//
+// A FreeTreeBuilder can only be built once.
+type FreeTreeBuilder struct {
+	layout    Layout
+	dataChunk mmm.MemChunk
+	typ       reflect.Type
+	last      Comparable
+	sorted    bool
+	capacity  int
+	len       int
+	err       error
+}
+
+// NewFreeTreeBuilder returns a new FreeTreeBuilder.
+//
+// `n` is the number of elements you're expecting to add: it is only used to
+// size the builder's initial memory chunk, which grows as needed.
+func NewFreeTreeBuilder(n int) *FreeTreeBuilder {
+	if n < 1 {
+		n = 1
+	}
+	return &FreeTreeBuilder{capacity: n, sorted: true}
+}
+
+// SetLayout sets the memory layout of the tree to build; PointerLayout is
+// used by default.
+func (b *FreeTreeBuilder) SetLayout(layout Layout) *FreeTreeBuilder {
+	b.layout = layout
+
+	return b
+}
+
+// Add appends `c` to the builder.
+//
+// All elements must be of the same type; once Add has returned an error,
+// all subsequent calls to Add and Build will return that same error.
+func (b *FreeTreeBuilder) Add(c Comparable) error {
+	if b.err != nil {
+		return b.err
+	}
+
+	switch {
+	case b.len == 0:
+		if b.err = ValidateComparable(c); b.err == nil {
+			b.dataChunk, b.err = mmm.NewMemChunk(c, uint(b.capacity))
+		}
+		b.typ = reflect.TypeOf(c)
+	case reflect.TypeOf(c) != b.typ:
+		b.err = fmt.Errorf("freetree: cannot mix elements of type %v and %T", b.typ, c)
+	case b.len == b.capacity:
+		b.dataChunk, b.err = growChunk(b.dataChunk, c, 2*b.capacity, b.len, b.typ.Size())
+		if b.err == nil {
+			b.capacity *= 2
+		}
+	}
+	if b.err != nil {
+		return b.err
+	}
+
+	if b.last != nil && c.Less(b.last) {
+		b.sorted = false
+	}
+	b.dataChunk.Write(b.len, c)
+	b.last = c
+	b.len++
+
+	return nil
+}
+
+// Build returns a new FreeTree using the elements added to the builder so
+// far.
+//
+// The builder cannot be used anymore once Build has been called.
+func (b *FreeTreeBuilder) Build() (*FreeTree, error) {
+	if b.err != nil {
+		return nil, b.err
+	}
+	if b.len == 0 {
+		b.err = ErrBuilderDone
+		return track(&FreeTree{layout: b.layout, root: noNode, free: noNode}), nil
+	}
+	if b.len >= math.MaxUint32 {
+		return nil, ErrTooLarge
+	}
+
+	if !b.sorted {
+		sort.Sort(chunkSorter{c: borrowChunk(b.dataChunk, b.last, b.len)})
+		b.sorted = true
+	}
+
+	var ft *FreeTree
+	switch b.layout {
+	case PointerLayout:
+		nodeChunk, err := mmm.NewMemChunk(freeNode{}, uint(b.len))
+		if err != nil {
+			return nil, err
+		}
+		ft = &FreeTree{
+			nodeChunk: newChunk(nodeChunk, freeNode{}, b.len),
+			dataChunk: newChunk(b.dataChunk, b.last, b.len),
+			slots:     uint32(b.len),
+			free:      noNode,
+		}
+		ft.root = ft.layoutSorted(0, uint32(b.len))
+	case EytzingerLayout:
+		dataChunk, err := eytzinger(b.dataChunk, b.last, b.len, b.typ.Size())
+		if err != nil {
+			return nil, err
+		}
+		b.dataChunk.Delete()
+		ft = &FreeTree{
+			layout:    EytzingerLayout,
+			dataChunk: newChunk(dataChunk, b.last, b.len),
+			root:      0,
+			slots:     uint32(b.len),
+			free:      noNode,
+		}
+	default:
+		return nil, fmt.Errorf("freetree: unknown layout: %v", b.layout)
+	}
+
+	b.dataChunk = mmm.MemChunk{}
+	b.last = nil
+	b.err = ErrBuilderDone
+
+	return track(ft), nil
+}
+
+// Delete deletes the memory chunks associated with the builder.
+//
+// It is only needed if the builder is discarded before Build has been called.
+func (b *FreeTreeBuilder) Delete() *FreeTreeBuilder {
+	if b.len > 0 && b.err != ErrBuilderDone {
+		b.dataChunk.Delete()
+	}
+	b.last = nil
+	b.err = ErrBuilderDone
+
+	return nil
+}
+
+// layoutSorted sets up a perfectly balanced tree on top of the sorted data
+// in [lo, hi) and returns the index of its root.
+//
+// Node i always points to the i-th smallest element of the data chunk, and
+// subtrees are split the same way SimpleTree.insert() splits its input.
+func (ft FreeTree) layoutSorted(lo, hi uint32) uint32 {
+	if lo >= hi {
+		return noNode
+	}
+
+	mid := lo + (hi-lo)/2
+	node := ft.node(mid)
+	node.left = ft.layoutSorted(lo, mid)
+	node.right = ft.layoutSorted(mid+1, hi)
+	ft.update(mid)
+
+	return mid
+}
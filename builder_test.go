@@ -0,0 +1,163 @@
+// Copyright © 2015 Clement 'cmc' Rey <cr.rey.clement@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package freetree
+
+import "testing"
+
+// -----------------------------------------------------------------------------
+
+func TestNewFreeTreeFromSorted(t *testing.T) {
+	for n := 1; n <= 17; n++ {
+		ca := make(ComparableArray, n)
+		for i := range ca {
+			ca[i] = intTest(i)
+		}
+
+		ft, err := NewFreeTreeFromSorted(ca)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ref, err := NewFreeTree(NewSimpleTree().InsertArray(ca))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		checkArray(t, "PostOrder", ref.Flatten(), ft.Flatten())
+		checkArray(t, "InOrder", ca, ft.FlattenOrder(InOrder))
+		for _, c := range ca {
+			if ft.Ascend(c) != c {
+				t.Errorf("Ascend(%v): unexpected retval", c)
+			}
+			if ft.Select(int(c.(intTest))) != c {
+				t.Errorf("Select(%v): unexpected retval", c)
+			}
+		}
+		if ft.Ascend(intTest(n)) != nil {
+			t.Error("unexpected retval")
+		}
+
+		ref.Delete()
+		ft.Delete()
+	}
+}
+
+func TestNewFreeTreeFromSorted_unsorted_input(t *testing.T) {
+	ca := ComparableArray{intTest(1), intTest(3), intTest(2)}
+
+	if _, err := NewFreeTreeFromSorted(ca); err != ErrNotSorted {
+		t.Errorf("expected ErrNotSorted, got %v", err)
+	}
+}
+
+func TestFreeTreeBuilder(t *testing.T) {
+	inputs := map[string][]intTest{
+		"sorted":   {1, 1, 2, 3, 4, 5, 6, 7, 8, 9},
+		"unsorted": {9, 1, 8, 2, 7, 3, 6, 4, 1, 5},
+	}
+	expected := ComparableArray{
+		intTest(1), intTest(1), intTest(2), intTest(3), intTest(4),
+		intTest(5), intTest(6), intTest(7), intTest(8), intTest(9),
+	}
+
+	for name, input := range inputs {
+		// start small so that the data chunk has to grow a few times
+		b := NewFreeTreeBuilder(1)
+		for _, c := range input {
+			if err := b.Add(c); err != nil {
+				t.Fatal(err)
+			}
+		}
+		ft, err := b.Build()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		checkArray(t, name, expected, ft.FlattenOrder(InOrder))
+		for _, c := range input {
+			if ft.Ascend(c) != c {
+				t.Errorf("%s: Ascend(%v): unexpected retval", name, c)
+			}
+		}
+		if ft.Ascend(intTest(0)) != nil || ft.Ascend(intTest(10)) != nil {
+			t.Errorf("%s: unexpected retval", name)
+		}
+		ft.Delete()
+	}
+}
+
+func TestFreeTreeBuilder_sort_allocs(t *testing.T) {
+	const n = 1000
+	allocs := testing.AllocsPerRun(10, func() {
+		b := NewFreeTreeBuilder(n)
+		for i := 0; i < n; i++ {
+			b.Add(intTest((i * 7919) % n))
+		}
+		ft, err := b.Build()
+		if err != nil {
+			t.Fatal(err)
+		}
+		ft.Delete()
+	})
+	// adding the elements boxes them, but sorting them mustn't allocate
+	if allocs > n {
+		t.Errorf("unexpected allocations: %v", allocs)
+	}
+}
+
+func TestFreeTreeBuilder_empty(t *testing.T) {
+	sorted, err := NewFreeTreeFromSorted(ComparableArray{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	eytzinger, err := NewFreeTreeBuilder(0).SetLayout(EytzingerLayout).Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, ft := range map[string]*FreeTree{"sorted": sorted, "eytzinger": eytzinger} {
+		if ft.Len() != 0 || ft.Ascend(intTest(1)) != nil || ft.Contains(intTest(1)) ||
+			ft.Rank(intTest(1)) != 0 || len(ft.Flatten()) != 0 {
+			t.Errorf("%s: unexpected retval", name)
+		}
+		ft.Delete()
+	}
+}
+
+func TestFreeTreeBuilder_errors(t *testing.T) {
+	b := NewFreeTreeBuilder(4)
+	b.Add(intTest(1))
+	if err := b.Add(Int(2)); err == nil {
+		t.Error("expected error")
+	}
+	b.Delete()
+
+	empty := NewFreeTreeBuilder(4)
+	ft, err := empty.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ft.Delete()
+	if _, err := empty.Build(); err != ErrBuilderDone {
+		t.Errorf("expected ErrBuilderDone, got %v", err)
+	}
+
+	b = NewFreeTreeBuilder(4)
+	b.Add(intTest(1))
+	b.Add(intTest(2))
+	ft, err = b.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ft.Delete()
+
+	checkArray(t, "InOrder", ComparableArray{intTest(1), intTest(2)}, ft.FlattenOrder(InOrder))
+	if _, err := b.Build(); err != ErrBuilderDone {
+		t.Errorf("expected ErrBuilderDone, got %v", err)
+	}
+	if err := b.Add(intTest(3)); err != ErrBuilderDone {
+		t.Errorf("expected ErrBuilderDone, got %v", err)
+	}
+}
@@ -0,0 +1,238 @@
+// Copyright © 2015 Clement 'cmc' Rey <cr.rey.clement@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package freetree
+
+import (
+	"fmt"
+	"reflect"
+	"unsafe"
+
+	"github.com/teh-cmc/mmm"
+)
+
+// -----------------------------------------------------------------------------
+
+// chunk is an array of objects of the same type living off-heap: either in
+// an mmm.MemChunk or in a memory-mapped file.
+//
+// Its Read, Pointer and NbObjects methods behave like their mmm.MemChunk
+// counterparts, except that they panic with a meaningful message when used
+// out of bounds, or after the chunk has been deleted.
+type chunk struct {
+	typ  reflect.Type
+	base uintptr
+	size uintptr
+	len  int
+	itab unsafe.Pointer // itab of (Comparable, typ), if typ is a Comparable
+
+	mc    mmm.MemChunk // underlying memory chunk, if any
+	owned bool         // whether `mc` must be deleted along with the chunk
+}
+
+// newChunk returns a chunk reading the first `len` objects of `mc`, which
+// are of the same type as `v`.
+//
+// The returned chunk takes ownership of `mc`.
+func newChunk(mc mmm.MemChunk, v interface{}, len int) chunk {
+	return chunk{
+		typ:   reflect.TypeOf(v),
+		base:  mc.Pointer(0),
+		size:  reflect.TypeOf(v).Size(),
+		len:   len,
+		itab:  comparableItab(v),
+		mc:    mc,
+		owned: true,
+	}
+}
+
+// borrowChunk returns a chunk reading the first `len` objects of `mc`, which
+// are of the same type as `v`.
+//
+// The returned chunk doesn't take ownership of `mc`, which must outlive it.
+func borrowChunk(mc mmm.MemChunk, v interface{}, len int) chunk {
+	c := newChunk(mc, v, len)
+	c.owned = false
+	return c
+}
+
+// newBytesChunk returns a chunk reading `len` objects of the same type as `v`
+// from `b`, starting at `offset`.
+//
+// The returned chunk doesn't take ownership of `b`, which must outlive it.
+func newBytesChunk(b []byte, offset int, v interface{}, len int) chunk {
+	c := chunk{
+		typ:  reflect.TypeOf(v),
+		size: reflect.TypeOf(v).Size(),
+		len:  len,
+		itab: comparableItab(v),
+	}
+	if len > 0 {
+		c.base = uintptr(unsafe.Pointer(&b[offset]))
+	}
+	return c
+}
+
+// NbObjects returns the number of objects in the chunk.
+func (c chunk) NbObjects() uint { return uint(c.len) }
+
+// Pointer returns a pointer to the i-th object of the chunk.
+//
+// This will panic if `i` is out of bounds.
+func (c chunk) Pointer(i int) uintptr {
+	if i < 0 || i >= c.len {
+		if c.base == 0 {
+			panic("freetree: use of a deleted chunk")
+		}
+		panic(fmt.Sprintf("freetree: index out of range [%d] with length %d", i, c.len))
+	}
+	return c.base + uintptr(i)*c.size
+}
+
+// Read returns a copy of the i-th object of the chunk.
+//
+// This will panic if `i` is out of bounds.
+func (c chunk) Read(i int) interface{} {
+	return reflect.NewAt(c.typ, unsafe.Pointer(c.Pointer(i))).Elem().Interface()
+}
+
+// View returns the i-th object of the chunk as a Comparable, without copying
+// it: the returned interface points directly into the chunk's memory.
+//
+// It never allocates, but the returned Comparable must not outlive the
+// chunk, nor be retained in any way: it is only meant to be compared.
+// This will panic if `i` is out of bounds, or if the objects in the chunk
+// are not Comparables.
+func (c chunk) View(i int) Comparable {
+	if c.itab == nil {
+		panic(fmt.Sprintf("freetree: %v is not a Comparable", c.typ))
+	}
+
+	var v Comparable
+	*(*iface)(unsafe.Pointer(&v)) = iface{tab: c.itab, data: unsafe.Pointer(c.Pointer(i))}
+	return v
+}
+
+// Write writes `v` to the i-th object of the chunk.
+//
+// This will panic if `i` is out of bounds, or if `v` is of a different type
+// than the other objects in the chunk.
+func (c chunk) Write(i int, v interface{}) {
+	reflect.NewAt(c.typ, unsafe.Pointer(c.Pointer(i))).Elem().Set(reflect.ValueOf(v))
+}
+
+// Bytes returns the raw memory of the first `n` objects of the chunk.
+//
+// The returned slice points to off-heap memory: it must not outlive `c`.
+func (c chunk) Bytes(n int) []byte {
+	if n == 0 {
+		return nil
+	}
+	c.Pointer(n - 1) // bounds check
+	return unsafe.Slice((*byte)(unsafe.Pointer(c.base)), uintptr(n)*c.size)
+}
+
+// Grow reallocates the chunk's underlying memory so that it can hold `n`
+// objects, the current ones being copied over.
+//
+// Only chunks that own their memory can grow.
+func (c *chunk) Grow(n int) error {
+	if !c.owned {
+		return ErrReadOnly
+	}
+
+	mc, err := growChunk(c.mc, reflect.Zero(c.typ).Interface(), n, c.len, c.size)
+	if err != nil {
+		return err
+	}
+	c.mc, c.base, c.len = mc, mc.Pointer(0), n
+
+	return nil
+}
+
+// Delete releases the memory owned by the chunk, if any.
+func (c *chunk) Delete() error {
+	var err error
+	if c.owned {
+		err = c.mc.Delete()
+	}
+	*c = chunk{}
+
+	return err
+}
+
+// -----------------------------------------------------------------------------
+
+// iface is the memory layout of a non-empty interface, such as a Comparable.
+//
+// The objects stored in a chunk never contain pointers, hence are never
+// stored directly in an interface: its data word always points to a copy of
+// the object, which is what allows View() to point it to the chunk instead.
+type iface struct {
+	tab  unsafe.Pointer
+	data unsafe.Pointer
+}
+
+// comparableItab returns the itab that a Comparable holding a value of the
+// same type as `v` uses, or nil if `v` is not a Comparable.
+func comparableItab(v interface{}) unsafe.Pointer {
+	c, ok := v.(Comparable)
+	if !ok {
+		return nil
+	}
+	return (*iface)(unsafe.Pointer(&c)).tab
+}
+
+// chunkBytes returns the raw memory of the objects in [i, j) of `mc`, each
+// of them being `size` bytes long.
+//
+// The returned slice points to off-heap memory: it must not outlive `mc`.
+func chunkBytes(mc mmm.MemChunk, i, j int, size uintptr) []byte {
+	if i >= j {
+		return nil
+	}
+	return unsafe.Slice((*byte)(unsafe.Pointer(mc.Pointer(i))), uintptr(j-i)*size)
+}
+
+// growChunk returns a new chunk with room for `n` objects of the same type
+// as `v`, and copies the first `len` objects of `mc` into it.
+//
+// `mc` is deleted on success; it is left untouched otherwise.
+func growChunk(mc mmm.MemChunk, v interface{}, n, len int, size uintptr) (mmm.MemChunk, error) {
+	grown, err := mmm.NewMemChunk(v, uint(n))
+	if err != nil {
+		return mc, err
+	}
+	copy(chunkBytes(grown, 0, len, size), chunkBytes(mc, 0, len, size))
+	mc.Delete()
+
+	return grown, nil
+}
+
+// -----------------------------------------------------------------------------
+
+// chunkSorter implements sort.Interface on top of the Comparables of a
+// chunk; elements are compared and swapped in place, directly in off-heap
+// memory, so that sorting never allocates.
+type chunkSorter struct {
+	c chunk
+}
+
+// Len returns the number of elements to sort.
+func (cs chunkSorter) Len() int { return cs.c.len }
+
+// Less returns true if the i-th element < the j-th element.
+func (cs chunkSorter) Less(i, j int) bool {
+	return cs.c.View(i).Less(cs.c.View(j))
+}
+
+// Swap swaps the i-th and j-th elements.
+func (cs chunkSorter) Swap(i, j int) {
+	a := unsafe.Slice((*byte)(unsafe.Pointer(cs.c.Pointer(i))), cs.c.size)
+	b := unsafe.Slice((*byte)(unsafe.Pointer(cs.c.Pointer(j))), cs.c.size)
+	for k := range a {
+		a[k], b[k] = b[k], a[k]
+	}
+}
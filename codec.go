@@ -0,0 +1,153 @@
+// Copyright © 2015 Clement 'cmc' Rey <cr.rey.clement@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package freetree
+
+import (
+	"math"
+	"unsafe"
+
+	"github.com/teh-cmc/mmm"
+)
+
+// -----------------------------------------------------------------------------
+
+/////
+// Variable-size elements
+//
+// mmm can only store fixed-size objects that don't contain any pointer: a
+// FreeTree whose elements are strings, slices, or of different types,
+// instead serializes them into an off-heap arena of bytes, using a Codec.
+// Its data chunk then holds, for every node, the offset and length of the
+// node's element in the arena.
+//
+// Elements are decoded every time they are compared or returned: lookups
+// are slower than with fixed-size elements, and allocate.
+/////
+
+// Codec serializes the elements of a FreeTree created with
+// NewFreeTreeCodec().
+//
+// It may handle elements of different types, as long as they can be
+// compared with each other.
+type Codec interface {
+	// Append appends the encoding of `c` to `b`, and returns the extended
+	// buffer.
+	Append(b []byte, c Comparable) ([]byte, error)
+	// Decode returns the element encoded in `b`.
+	//
+	// `b` points to off-heap memory: it must not be retained by the
+	// returned element, which must copy whatever it needs.
+	Decode(b []byte) Comparable
+}
+
+// extent locates an encoded element in the arena of a FreeTree.
+type extent struct {
+	off uint64
+	len uint32
+}
+
+// arenaPage is the unit of allocation of an arena.
+type arenaPage [4096]byte
+
+// NewFreeTreeCodec returns a new FreeTree using the data from a supplied
+// SimpleTree, whose elements are serialized off-heap using `codec`.
+//
+// Contrary to NewFreeTree(), elements can be of any type, including strings,
+// slices and structs holding them; they can even be of different types if
+// `codec` supports it.
+// The returned tree is read-only.
+func NewFreeTreeCodec(st *SimpleTree, codec Codec) (*FreeTree, error) {
+	nbNodes := st.nodes
+	if nbNodes >= math.MaxUint32 {
+		return nil, ErrTooLarge
+	}
+	if nbNodes == 0 {
+		return track(&FreeTree{root: noNode, free: noNode, codec: codec}), nil
+	}
+	nodeChunk, err := mmm.NewMemChunk(freeNode{}, nbNodes)
+	if err != nil {
+		return nil, err
+	}
+	dataChunk, err := mmm.NewMemChunk(extent{}, nbNodes)
+	if err != nil {
+		nodeChunk.Delete()
+		return nil, err
+	}
+	arenaChunk, err := mmm.NewMemChunk(arenaPage{}, 1)
+	if err != nil {
+		dataChunk.Delete()
+		nodeChunk.Delete()
+		return nil, err
+	}
+
+	ft := &FreeTree{
+		nodeChunk: newChunk(nodeChunk, freeNode{}, int(nbNodes)),
+		dataChunk: newChunk(dataChunk, extent{}, int(nbNodes)),
+		arena:     newChunk(arenaChunk, arenaPage{}, 1),
+		codec:     codec,
+		slots:     uint32(nbNodes),
+		free:      noNode,
+	}
+	var buf []byte
+	var off uint64
+	ft.root = ft.layoutNodes(st, func(n *simpleNode) {
+		if err != nil {
+			return
+		}
+		if buf, err = codec.Append(buf[:0], n.data); err != nil {
+			return
+		}
+		if len(buf) > math.MaxUint32 {
+			err = ErrTooLarge
+			return
+		}
+		if err = ft.reserveArena(off + uint64(len(buf))); err != nil {
+			return
+		}
+		copy(arenaBytes(ft.arena, off, len(buf)), buf)
+		dataChunk.Write(int(n.id), extent{off: off, len: uint32(len(buf))})
+		off += uint64(len(buf))
+	})
+	if err != nil {
+		ft.Delete()
+		return nil, err
+	}
+
+	return track(ft), nil
+}
+
+// reserveArena makes sure that the arena can hold `n` bytes.
+func (ft *FreeTree) reserveArena(n uint64) error {
+	pageSize := uint64(unsafe.Sizeof(arenaPage{}))
+	if n <= uint64(ft.arena.len)*pageSize {
+		return nil
+	}
+
+	pages := 2 * ft.arena.len
+	if needed := int((n + pageSize - 1) / pageSize); needed > pages {
+		pages = needed
+	}
+	return ft.arena.Grow(pages)
+}
+
+// arenaBytes returns the `n` bytes of `arena` starting at offset `off`.
+//
+// The returned slice points to off-heap memory: it must not outlive the
+// arena.
+func arenaBytes(arena chunk, off uint64, n int) []byte {
+	if n == 0 {
+		return nil
+	}
+	b := arena.Bytes(arena.len)
+	return b[off : off+uint64(n) : off+uint64(n)]
+}
+
+// decode returns the element associated with the node at index `n`, in a
+// tree using a Codec.
+func (ft FreeTree) decode(n uint32) Comparable {
+	e := (*extent)(unsafe.Pointer(ft.dataChunk.Pointer(int(n))))
+	return ft.codec.Decode(arenaBytes(ft.arena, e.off, int(e.len)))
+}
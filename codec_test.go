@@ -0,0 +1,176 @@
+// Copyright © 2015 Clement 'cmc' Rey <cr.rey.clement@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package freetree
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"testing"
+)
+
+// -----------------------------------------------------------------------------
+
+type keyTest string
+
+func (k1 keyTest) Less(k2 Comparable) bool { return k1 < k2.(keyTest) }
+
+type keyCodec struct{}
+
+func (keyCodec) Append(b []byte, c Comparable) ([]byte, error) {
+	return append(b, c.(keyTest)...), nil
+}
+
+func (keyCodec) Decode(b []byte) Comparable { return keyTest(b) }
+
+// blobTest holds a slice, and is only ordered by its id.
+type blobTest struct {
+	id      int
+	payload []byte
+}
+
+func (b1 blobTest) Less(b2 Comparable) bool { return b1.id < b2.(blobTest).id }
+
+type blobCodec struct{}
+
+func (blobCodec) Append(b []byte, c Comparable) ([]byte, error) {
+	blob := c.(blobTest)
+	b = binary.AppendUvarint(b, uint64(blob.id))
+	return append(b, blob.payload...), nil
+}
+
+func (blobCodec) Decode(b []byte) Comparable {
+	id, n := binary.Uvarint(b)
+	return blobTest{id: int(id), payload: append([]byte(nil), b[n:]...)}
+}
+
+// numTest and wordTest can be mixed in a tree: numbers come first.
+type numTest int
+type wordTest string
+
+func (n1 numTest) Less(c Comparable) bool {
+	n2, ok := c.(numTest)
+	return !ok || n1 < n2
+}
+
+func (w1 wordTest) Less(c Comparable) bool {
+	w2, ok := c.(wordTest)
+	return ok && w1 < w2
+}
+
+type mixedCodec struct{}
+
+func (mixedCodec) Append(b []byte, c Comparable) ([]byte, error) {
+	if n, ok := c.(numTest); ok {
+		return binary.AppendVarint(append(b, 'n'), int64(n)), nil
+	}
+	return append(append(b, 'w'), c.(wordTest)...), nil
+}
+
+func (mixedCodec) Decode(b []byte) Comparable {
+	if b[0] == 'n' {
+		n, _ := binary.Varint(b[1:])
+		return numTest(n)
+	}
+	return wordTest(b[1:])
+}
+
+func TestFreeTree_codec(t *testing.T) {
+	st := NewSimpleTree()
+	for _, k := range []keyTest{"pear", "apple", "fig", "", "banana", "cherry"} {
+		st.Insert(k)
+	}
+
+	if _, err := NewFreeTree(st); err == nil {
+		t.Error("expected strings to be rejected without a Codec")
+	}
+	ft, err := NewFreeTreeCodec(st, keyCodec{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, order := range []TraversalOrder{PostOrder, InOrder, PreOrder, LevelOrder} {
+		checkArray(t, order.String(), st.FlattenOrder(order), ft.FlattenOrder(order))
+	}
+	if ft.Ascend(keyTest("fig")) != keyTest("fig") || ft.Ascend(keyTest("grape")) != nil ||
+		ft.Ascend(keyTest("")) != keyTest("") {
+		t.Error("Ascend: unexpected retval")
+	}
+	if ft.Rank(keyTest("cherry")) != 3 || ft.Floor(keyTest("grape")) != keyTest("fig") {
+		t.Error("unexpected retval")
+	}
+	var ca ComparableArray
+	ft.AscendRange(keyTest("b"), keyTest("g"), collect(&ca, -1))
+	checkArray(t, "AscendRange", ComparableArray{keyTest("banana"), keyTest("cherry"), keyTest("fig")}, ca)
+	it := ft.Iterator()
+	if it.Last(); it.Value() != keyTest("pear") {
+		t.Error("Last: unexpected retval")
+	}
+
+	if err := ft.Insert(keyTest("grape")); err != ErrReadOnly {
+		t.Errorf("Insert: expected ErrReadOnly, got %v", err)
+	}
+	if _, err := ft.Remove(keyTest("fig")); err != ErrReadOnly {
+		t.Errorf("Remove: expected ErrReadOnly, got %v", err)
+	}
+	if _, err := ft.WriteTo(io.Discard); err != ErrNotPersistable {
+		t.Errorf("WriteTo: expected ErrNotPersistable, got %v", err)
+	}
+	ft.Delete()
+
+	empty, err := NewFreeTreeCodec(NewSimpleTree(), keyCodec{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if empty.Len() != 0 || empty.Ascend(keyTest("fig")) != nil {
+		t.Error("unexpected retval")
+	}
+	empty.Delete()
+}
+
+func TestFreeTree_codec_slices(t *testing.T) {
+	// ~1MB of payloads: the arena has to grow many times
+	const n = 10000
+	ca := make(ComparableArray, n)
+	for i := range ca {
+		ca[i] = blobTest{id: i, payload: bytes.Repeat([]byte{byte(i)}, i%200)}
+	}
+	ft, err := NewFreeTreeCodec(NewSimpleTree().InsertArray(ca), blobCodec{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ft.Delete()
+
+	for i, c := range ft.FlattenOrder(InOrder) {
+		blob := c.(blobTest)
+		if blob.id != i || !bytes.Equal(blob.payload, ca[i].(blobTest).payload) {
+			t.Fatalf("unexpected element at %d: %v", i, blob.id)
+		}
+	}
+	if blob := ft.Ascend(blobTest{id: 4321}).(blobTest); !bytes.Equal(blob.payload, ca[4321].(blobTest).payload) {
+		t.Error("Ascend: unexpected payload")
+	}
+}
+
+func TestFreeTree_codec_mixed_types(t *testing.T) {
+	st := NewSimpleTree().Insert(wordTest("b"), numTest(2), wordTest("a"), numTest(-1), numTest(10))
+
+	if _, err := NewFreeTree(st); err == nil {
+		t.Error("expected mixed types to be rejected without a Codec")
+	}
+	ft, err := NewFreeTreeCodec(st, mixedCodec{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ft.Delete()
+
+	expected := ComparableArray{numTest(-1), numTest(2), numTest(10), wordTest("a"), wordTest("b")}
+	checkArray(t, "InOrder", expected, ft.FlattenOrder(InOrder))
+	if ft.Ascend(numTest(10)) != numTest(10) || ft.Ascend(wordTest("a")) != wordTest("a") ||
+		ft.Ascend(wordTest("c")) != nil {
+		t.Error("Ascend: unexpected retval")
+	}
+}
@@ -5,6 +5,12 @@
 
 package freetree
 
+import (
+	"errors"
+	"fmt"
+	"reflect"
+)
+
 // -----------------------------------------------------------------------------
 
 // Comparable exposes a single Less method.
@@ -26,3 +32,74 @@ func (ca ComparableArray) Less(i, j int) bool { return ca[i].Less(ca[j]) }
 
 // Swap swaps the values of `ca[i]` and `ca[j]`.
 func (ca ComparableArray) Swap(i, j int) { ca[i], ca[j] = ca[j], ca[i] }
+
+// -----------------------------------------------------------------------------
+
+// ValidateComparable returns an error if `c` cannot be stored in a FreeTree,
+// i.e. if its type contains pointers of any kind: pointers, strings, slices,
+// maps, channels, functions or interfaces.
+//
+// The error names the offending field, e.g.
+//
+//	freetree: field Entry.name is a string, which cannot be stored off-heap
+//
+// Such elements can still be stored using NewFreeTreeCodec().
+func ValidateComparable(c Comparable) error {
+	if c == nil {
+		return errors.New("freetree: nil Comparable")
+	}
+	return validateType(reflect.TypeOf(c))
+}
+
+// validateType returns an error if values of type `t` contain pointers.
+func validateType(t reflect.Type) error {
+	if t == nil {
+		return errors.New("freetree: nil value")
+	}
+	name := t.Name()
+	if name == "" {
+		name = t.String()
+	}
+	path, kind := pointerPath(t, name)
+	if path == "" {
+		return nil
+	}
+	if path == name {
+		return fmt.Errorf("freetree: %s is %s, which cannot be stored off-heap", path, kind)
+	}
+	return fmt.Errorf("freetree: field %s is %s, which cannot be stored off-heap", path, kind)
+}
+
+// pointerPath returns the path to the first part of `t` that contains a
+// pointer, starting with `path`, along with a description of its kind; or
+// an empty path if there is no such part.
+func pointerPath(t reflect.Type, path string) (string, string) {
+	switch t.Kind() {
+	case reflect.Ptr:
+		return path, "a pointer"
+	case reflect.UnsafePointer:
+		return path, "an unsafe.Pointer"
+	case reflect.String:
+		return path, "a string"
+	case reflect.Slice:
+		return path, "a slice"
+	case reflect.Map:
+		return path, "a map"
+	case reflect.Chan:
+		return path, "a channel"
+	case reflect.Func:
+		return path, "a function"
+	case reflect.Interface:
+		return path, "an interface"
+	case reflect.Array:
+		return pointerPath(t.Elem(), path+"[]")
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if path, kind := pointerPath(f.Type, path+"."+f.Name); path != "" {
+				return path, kind
+			}
+		}
+	}
+	return "", ""
+}
@@ -0,0 +1,65 @@
+// Copyright © 2015 Clement 'cmc' Rey <cr.rey.clement@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package freetree
+
+import (
+	"strings"
+	"testing"
+)
+
+// -----------------------------------------------------------------------------
+
+type nestedTest struct {
+	id    int
+	inner struct {
+		weights [4]float64
+		tags    [2][]byte
+	}
+}
+
+func (n1 nestedTest) Less(n2 Comparable) bool { return n1.id < n2.(nestedTest).id }
+
+type pointerTest struct {
+	next *pointerTest
+}
+
+func (p1 pointerTest) Less(p2 Comparable) bool { return false }
+
+func TestValidateComparable(t *testing.T) {
+	for _, c := range []Comparable{intTest(0), eventTest{}, numTest(0)} {
+		if err := ValidateComparable(c); err != nil {
+			t.Errorf("%T: unexpected error: %v", c, err)
+		}
+	}
+
+	for _, test := range []struct {
+		c        Comparable
+		expected string
+	}{
+		{keyTest(""), "freetree: keyTest is a string, which"},
+		{blobTest{}, "freetree: field blobTest.payload is a slice, which"},
+		{nestedTest{}, "freetree: field nestedTest.inner.tags[] is a slice, which"},
+		{pointerTest{}, "freetree: field pointerTest.next is a pointer, which"},
+		{nil, "freetree: nil Comparable"},
+	} {
+		if err := ValidateComparable(test.c); err == nil || !strings.HasPrefix(err.Error(), test.expected) {
+			t.Errorf("%T: expected %q, got %v", test.c, test.expected, err)
+		}
+	}
+}
+
+func TestNewFreeTree_invalid_type(t *testing.T) {
+	st := NewSimpleTree().Insert(blobTest{id: 1}, blobTest{id: 2})
+
+	_, err := NewFreeTree(st)
+	if err == nil || !strings.Contains(err.Error(), "blobTest.payload") {
+		t.Errorf("NewFreeTree: unexpected error: %v", err)
+	}
+	_, err = NewFreeTreeFromSorted(st.FlattenOrder(InOrder))
+	if err == nil || !strings.Contains(err.Error(), "blobTest.payload") {
+		t.Errorf("NewFreeTreeFromSorted: unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,48 @@
+// Copyright © 2015 Clement 'cmc' Rey <cr.rey.clement@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package freetree
+
+import (
+	"errors"
+	"fmt"
+)
+
+// -----------------------------------------------------------------------------
+
+// ErrDuplicate is returned when adding an element to a SimpleTree that
+// rejects duplicates, and already holds an element == to it.
+var ErrDuplicate = errors.New("freetree: duplicate element")
+
+// Duplicates defines what a SimpleTree does when inserting an element that
+// is == to an element it already holds.
+type Duplicates int
+
+const (
+	// AllowDuplicates keeps all the elements: the tree is a multiset, whose
+	// equal elements can be enumerated using AscendEqual() and counted using
+	// Count().
+	// This is the default policy.
+	AllowDuplicates Duplicates = iota
+	// ReplaceDuplicates replaces the element already in the tree with the
+	// inserted one.
+	ReplaceDuplicates
+	// RejectDuplicates keeps the element already in the tree and drops the
+	// inserted one; Add() reports it as an ErrDuplicate.
+	RejectDuplicates
+)
+
+// String returns the name of the policy.
+func (d Duplicates) String() string {
+	switch d {
+	case AllowDuplicates:
+		return "AllowDuplicates"
+	case ReplaceDuplicates:
+		return "ReplaceDuplicates"
+	case RejectDuplicates:
+		return "RejectDuplicates"
+	}
+	return fmt.Sprintf("Duplicates(%d)", int(d))
+}
@@ -0,0 +1,124 @@
+// Copyright © 2015 Clement 'cmc' Rey <cr.rey.clement@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package freetree
+
+import "testing"
+
+// -----------------------------------------------------------------------------
+
+// eventTest is only ordered by its key: events with the same key are ==.
+type eventTest struct {
+	key, seq int
+}
+
+func (e1 eventTest) Less(e2 Comparable) bool { return e1.key < e2.(eventTest).key }
+
+func TestSimpleTree_multiset(t *testing.T) {
+	for _, balancing := range []Balancing{NoBalancing, AVLBalancing, RedBlackBalancing, TreapBalancing} {
+		st := NewBalancedSimpleTree(balancing)
+		for i := 0; i < 100; i++ {
+			st.Insert(eventTest{key: i % 10, seq: i})
+		}
+
+		ft, err := NewFreeTree(st)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for key := 0; key < 10; key++ {
+			pivot := eventTest{key: key}
+			if st.Count(pivot) != 10 || ft.Count(pivot) != 10 {
+				t.Errorf("%v: Count(%d): unexpected retval", balancing, key)
+			}
+
+			seen := make(map[int]bool)
+			st.AscendEqual(pivot, func(c Comparable) bool {
+				e := c.(eventTest)
+				if e.key != key || seen[e.seq] {
+					t.Errorf("%v: AscendEqual(%d): unexpected element %v", balancing, key, e)
+				}
+				seen[e.seq] = true
+				return true
+			})
+			if len(seen) != 10 {
+				t.Errorf("%v: AscendEqual(%d): expected 10 elements, got %d", balancing, key, len(seen))
+			}
+
+			var fromFree ComparableArray
+			ft.AscendEqual(pivot, collect(&fromFree, -1))
+			if len(fromFree) != 10 {
+				t.Errorf("%v: AscendEqual(%d): expected 10 elements, got %d", balancing, key, len(fromFree))
+			}
+		}
+		if st.Count(eventTest{key: 10}) != 0 || ft.Count(eventTest{key: 10}) != 0 {
+			t.Errorf("%v: unexpected retval", balancing)
+		}
+
+		var some ComparableArray
+		ft.AscendEqual(eventTest{key: 3}, collect(&some, 4))
+		if len(some) != 4 {
+			t.Errorf("%v: expected iteration to stop", balancing)
+		}
+		ft.Delete()
+	}
+}
+
+func TestSimpleTree_unique(t *testing.T) {
+	st := NewSimpleTree().SetDuplicates(ReplaceDuplicates)
+	st.Insert(eventTest{1, 0}, eventTest{2, 0}, eventTest{1, 1})
+	if err := st.Add(eventTest{2, 1}); err != nil {
+		t.Error(err)
+	}
+	if st.Len() != 2 {
+		t.Errorf("unexpected length: %d", st.Len())
+	}
+	if st.Ascend(eventTest{key: 1}) != (eventTest{1, 1}) || st.Ascend(eventTest{key: 2}) != (eventTest{2, 1}) {
+		t.Error("unexpected retval")
+	}
+
+	st = NewSimpleTree().SetDuplicates(RejectDuplicates)
+	st.Insert(eventTest{1, 0}, eventTest{2, 0}, eventTest{1, 1})
+	if err := st.Add(eventTest{2, 1}); err != ErrDuplicate {
+		t.Errorf("expected ErrDuplicate, got %v", err)
+	}
+	if err := st.Add(eventTest{3, 1}); err != nil {
+		t.Error(err)
+	}
+	if st.Len() != 3 {
+		t.Errorf("unexpected length: %d", st.Len())
+	}
+	if st.Ascend(eventTest{key: 1}) != (eventTest{1, 0}) || st.Ascend(eventTest{key: 2}) != (eventTest{2, 0}) {
+		t.Error("unexpected retval")
+	}
+
+	// ids must stay dense
+	ft, err := NewFreeTree(st)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ft.Delete()
+	if ft.Len() != 3 || ft.Ascend(eventTest{key: 3}) != (eventTest{3, 1}) {
+		t.Error("unexpected retval")
+	}
+}
+
+func TestSimpleTree_rebalance_keeps_duplicates(t *testing.T) {
+	for _, duplicates := range []Duplicates{ReplaceDuplicates, RejectDuplicates} {
+		st := NewSimpleTree().Insert(eventTest{1, 1}, eventTest{1, 2}, eventTest{2, 3})
+		st.SetDuplicates(duplicates).Rebalance()
+
+		if st.Len() != 3 || st.Count(eventTest{key: 1}) != 2 {
+			t.Errorf("%v: expected duplicates to be kept, got %v", duplicates, st.FlattenOrder(InOrder))
+		}
+		ft, err := NewFreeTree(st)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ft.Len() != 3 {
+			t.Errorf("%v: unexpected length: %d", duplicates, ft.Len())
+		}
+		ft.Delete()
+	}
+}
@@ -44,6 +44,8 @@ func main() {
 
 	// print [17 66 42]
 	fmt.Println(st.Flatten())
+	// print [17 42 66]
+	fmt.Println(st.FlattenOrder(freetree.InOrder))
 
 	// build a new FreeTree using the data from the SimpleTree
 	ft, err := freetree.NewFreeTree(st)
@@ -61,6 +63,8 @@ func main() {
 
 	// print [17 66 42]
 	fmt.Println(ft.Flatten())
+	// print [17 42 66]
+	fmt.Println(ft.FlattenOrder(freetree.InOrder))
 
 	// delete the FreeTree
 	ft.Delete()
@@ -46,7 +46,7 @@ func main() {
 	////////////////////////////////////////
 	// A: Normal BST, 10 million integers //
 	////////////////////////////////////////
-	fmt.Println(`Case A: GC performances while storing 10 million integers in a classic binary search tree` + "\n")
+	fmt.Print(`Case A: GC performances while storing 10 million integers in a classic binary search tree` + "\n\n")
 
 	// build a new BST and insert our 10 million integers in it
 	// our integers are pre-sorted, so the tree will be perfectly balanced (because
@@ -85,7 +85,7 @@ func main() {
 	//////////////////////////////////////
 	// B: FreeTree, 10 million integers //
 	//////////////////////////////////////
-	fmt.Println(`Case B: GC performances while storing 10 million integers in a FreeTree (i.e. a binary search tree with no GC overhead)` + "\n")
+	fmt.Print(`Case B: GC performances while storing 10 million integers in a FreeTree (i.e. a binary search tree with no GC overhead)` + "\n\n")
 
 	// build a new FreeTree using the data from our SimpleTree
 	ft, err := freetree.NewFreeTree(st)
@@ -0,0 +1,129 @@
+// Copyright © 2015 Clement 'cmc' Rey <cr.rey.clement@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package freetree
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+
+	"github.com/teh-cmc/mmm"
+)
+
+// -----------------------------------------------------------------------------
+
+// FreeMap implements a sorted map with zero GC overhead.
+//
+// Internally, a FreeMap is a FreeTree of keys, plus a separate memory chunk
+// where the i-th value is associated with the key of the i-th node.
+type FreeMap struct {
+	keys       FreeTree
+	valueChunk chunk
+}
+
+// NewFreeMap returns a new FreeMap using the data from a supplied SimpleMap.
+//
+// All keys must be of the same type, and so must all values.
+func NewFreeMap(sm *SimpleMap) (*FreeMap, error) {
+	st := sm.tree
+	nbNodes := st.nodes
+	if nbNodes >= math.MaxUint32 {
+		return nil, ErrTooLarge
+	}
+	if nbNodes == 0 {
+		return &FreeMap{keys: FreeTree{root: noNode, free: noNode}}, nil
+	}
+	e := st.root.data.(mapEntry)
+	if err := ValidateComparable(e.key); err != nil {
+		return nil, err
+	}
+	if err := validateType(reflect.TypeOf(e.value)); err != nil {
+		return nil, err
+	}
+	if err := checkEntryTypes(st); err != nil {
+		return nil, err
+	}
+	nodeChunk, err := mmm.NewMemChunk(freeNode{}, nbNodes)
+	if err != nil {
+		return nil, err
+	}
+	keyChunk, err := mmm.NewMemChunk(e.key, nbNodes)
+	if err != nil {
+		nodeChunk.Delete()
+		return nil, err
+	}
+	valueChunk, err := mmm.NewMemChunk(e.value, nbNodes)
+	if err != nil {
+		keyChunk.Delete()
+		nodeChunk.Delete()
+		return nil, err
+	}
+
+	fm := &FreeMap{
+		keys: FreeTree{
+			nodeChunk: newChunk(nodeChunk, freeNode{}, int(nbNodes)),
+			dataChunk: newChunk(keyChunk, e.key, int(nbNodes)),
+			slots:     uint32(nbNodes),
+			free:      noNode,
+		},
+		valueChunk: newChunk(valueChunk, e.value, int(nbNodes)),
+	}
+	fm.keys.root = fm.keys.layoutNodes(st, func(n *simpleNode) {
+		e := n.data.(mapEntry)
+		keyChunk.Write(int(n.id), e.key)
+		valueChunk.Write(int(n.id), e.value)
+	})
+
+	return fm, nil
+}
+
+// checkEntryTypes returns an error if the keys of `st` are not all of the
+// same type, or if its values aren't.
+func checkEntryTypes(st *SimpleTree) error {
+	var err error
+	root := st.root.data.(mapEntry)
+	keyType, valueType := reflect.TypeOf(root.key), reflect.TypeOf(root.value)
+	st.root.walk(PreOrder, func(n *simpleNode) {
+		if err != nil {
+			return
+		}
+		e := n.data.(mapEntry)
+		if reflect.TypeOf(e.key) != keyType {
+			err = fmt.Errorf("freetree: cannot mix keys of type %v and %T", keyType, e.key)
+		} else if reflect.TypeOf(e.value) != valueType {
+			err = fmt.Errorf("freetree: cannot mix values of type %v and %T", valueType, e.value)
+		}
+	})
+
+	return err
+}
+
+// Get returns the value associated with `key`.
+// The boolean is false if there is no such key in the map.
+func (fm FreeMap) Get(key Comparable) (interface{}, bool) {
+	fm.keys.checkOpen()
+	n := fm.keys.find(key)
+	if n == noNode {
+		return nil, false
+	}
+	return fm.valueChunk.Read(int(n)), true
+}
+
+// Len returns the number of keys in the map.
+func (fm FreeMap) Len() int {
+	return fm.keys.Len()
+}
+
+// Delete deletes the memory chunks associated with the map.
+//
+// Deleting a map twice is a no-op; any other use of a deleted map panics
+// with ErrClosed.
+func (fm *FreeMap) Delete() *FreeMap {
+	fm.valueChunk.Delete()
+	fm.keys.Delete()
+
+	return nil
+}
@@ -0,0 +1,71 @@
+// Copyright © 2015 Clement 'cmc' Rey <cr.rey.clement@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package freetree
+
+import "testing"
+
+// -----------------------------------------------------------------------------
+
+func TestFreeMap_get(t *testing.T) {
+	sm := NewSimpleMap()
+	sm.Insert(intTest(5), payloadTest{5, 50}).
+		Insert(intTest(4), payloadTest{4, 40}).
+		Insert(intTest(6), payloadTest{6, 60}).
+		Insert(intTest(1), payloadTest{1, 10})
+
+	fm, err := NewFreeMap(sm.Rebalance())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fm.Delete()
+
+	if fm.Len() != 4 {
+		t.Error("unexpected retval")
+	}
+	for _, k := range []intTest{1, 4, 5, 6} {
+		v, ok := fm.Get(k)
+		if !ok || v.(payloadTest) != (payloadTest{int(k), int(k) * 10}) {
+			t.Errorf("Get(%v): unexpected retval: %v", k, v)
+		}
+	}
+	if v, ok := fm.Get(intTest(2)); ok || v != nil {
+		t.Error("unexpected retval")
+	}
+	if v, ok := fm.Get(intTest(7)); ok || v != nil {
+		t.Error("unexpected retval")
+	}
+}
+
+func TestFreeMap_empty(t *testing.T) {
+	fm, err := NewFreeMap(NewSimpleMap())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fm.Delete()
+
+	if v, ok := fm.Get(intTest(1)); ok || v != nil || fm.Len() != 0 {
+		t.Error("unexpected retval")
+	}
+}
+
+func TestFreeMap_pointers_rejected(t *testing.T) {
+	sm := NewSimpleMap().Insert(intTest(1), "one")
+
+	if _, err := NewFreeMap(sm); err == nil {
+		t.Error("expected error")
+	}
+}
+
+func TestFreeMap_mixed_types_rejected(t *testing.T) {
+	for _, sm := range []*SimpleMap{
+		NewSimpleMap().Insert(intTest(1), 1).Insert(intTest(2), int64(2)),
+		NewSimpleMap().Insert(numTest(1), 1).Insert(wordTest("two"), 2),
+	} {
+		if _, err := NewFreeMap(sm); err == nil {
+			t.Error("expected error")
+		}
+	}
+}
@@ -6,6 +6,10 @@
 package freetree
 
 import (
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
 	"unsafe"
 
 	"github.com/teh-cmc/mmm"
@@ -13,102 +17,593 @@ import (
 
 // -----------------------------------------------------------------------------
 
+// ErrTooLarge is returned when trying to build a FreeTree with more than
+// math.MaxUint32 - 1 elements.
+var ErrTooLarge = errors.New("freetree: too many elements")
+
+// ErrClosed is returned, or used as a panic value by the methods that don't
+// return errors, when using a FreeTree after it has been deleted.
+var ErrClosed = errors.New("freetree: use of a deleted tree")
+
 // FreeTree implements a binary search tree with zero GC overhead.
+//
+// Lookups that only walk down the tree take a FreeTree; methods that modify
+// the tree, or that walk it using an Iterator, take a *FreeTree: an Iterator
+// keeps a pointer to its tree, which would otherwise make every call copy the
+// tree to the heap.
 type FreeTree struct {
-	nodeChunk mmm.MemChunk
-	dataChunk mmm.MemChunk
-	root      *freeNode
+	layout    Layout
+	nodeChunk chunk // unused by the EytzingerLayout
+	dataChunk chunk
+	root      uint32
+	slots     uint32 // number of slots used in the chunks, free ones included
+	free      uint32 // index of the first free slot, or noNode
+	mapping   []byte // file mapping the chunks point into, if any
+	closed    bool   // whether Delete() has been called
+
+	// trees using a Codec store extents in their data chunk, see codec.go
+	codec Codec
+	arena chunk
 }
 
 // NewFreeTree returns a new FreeTree using the data from a supplied SimpleTree.
+//
+// Elements must all be of the same type, which must be accepted by
+// ValidateComparable(); use NewFreeTreeCodec() otherwise.
+// An empty SimpleTree makes for an empty FreeTree, which allocates no memory
+// until elements are inserted into it.
 func NewFreeTree(st *SimpleTree) (*FreeTree, error) {
 	nbNodes := st.nodes
+	if nbNodes >= math.MaxUint32 {
+		return nil, ErrTooLarge
+	}
+	if nbNodes == 0 {
+		return track(&FreeTree{root: noNode, free: noNode}), nil
+	}
+	if err := ValidateComparable(st.root.data); err != nil {
+		return nil, err
+	}
+	if err := checkTypes(st); err != nil {
+		return nil, err
+	}
 	nodeChunk, err := mmm.NewMemChunk(freeNode{}, nbNodes)
 	if err != nil {
 		return nil, err
 	}
 	dataChunk, err := mmm.NewMemChunk(st.root.data, nbNodes)
 	if err != nil {
+		nodeChunk.Delete()
 		return nil, err
 	}
 
-	ft := &FreeTree{nodeChunk: nodeChunk, dataChunk: dataChunk}
+	ft := &FreeTree{
+		nodeChunk: newChunk(nodeChunk, freeNode{}, int(nbNodes)),
+		dataChunk: newChunk(dataChunk, st.root.data, int(nbNodes)),
+		slots:     uint32(nbNodes),
+		free:      noNode,
+	}
+	ft.root = ft.layoutNodes(st, func(n *simpleNode) {
+		dataChunk.Write(int(n.id), n.data)
+	})
+
+	return track(ft), nil
+}
+
+// checkTypes returns an error if the elements of `st` are not all of the same
+// type: use NewFreeTreeCodec() for those.
+func checkTypes(st *SimpleTree) error {
+	var err error
+	typ := reflect.TypeOf(st.root.data)
+	st.root.walk(PreOrder, func(n *simpleNode) {
+		if err == nil && reflect.TypeOf(n.data) != typ {
+			err = fmt.Errorf("freetree: cannot mix elements of type %v and %T", typ, n.data)
+		}
+	})
+
+	return err
+}
+
+// layoutNodes copies the nodes of `st` into the tree's node chunk and returns
+// the index of the root.
+//
+// Node i is the node whose id is i; `write` is called once per node, so that
+// the caller can copy the node's data into its own chunk(s).
+func (ft FreeTree) layoutNodes(st *SimpleTree, write func(n *simpleNode)) uint32 {
+	root := noNode
+	// nodes are flattened in post-order: children are always set up before
+	// their parent, so subtree sizes can be computed on the fly
 	for _, n := range st.flattenNodes() {
-		node := (*freeNode)(unsafe.Pointer(ft.nodeChunk.Pointer(int(n.id))))
-		node.id = n.id
+		node := ft.node(uint32(n.id))
+		node.left, node.right = noNode, noNode
 		if n.left != nil {
-			node.left = nodeChunk.Pointer(int(n.left.id))
+			node.left = uint32(n.left.id)
 		}
 		if n.right != nil {
-			node.right = nodeChunk.Pointer(int(n.right.id))
+			node.right = uint32(n.right.id)
 		}
-		dataChunk.Write(int(n.id), n.data)
+		ft.update(uint32(n.id))
+		write(n)
 
 		if n == st.root {
-			ft.root = node
+			root = uint32(n.id)
 		}
 	}
 
-	return ft, nil
+	return root
+}
+
+// node returns the node at index `n` in the node chunk.
+//
+// This will panic if `n` is out of bounds.
+func (ft FreeTree) node(n uint32) *freeNode {
+	return (*freeNode)(unsafe.Pointer(ft.nodeChunk.Pointer(int(n))))
+}
+
+// data returns a copy of the element associated with the node at index `n`.
+func (ft FreeTree) data(n uint32) Comparable {
+	if ft.codec != nil {
+		return ft.decode(n)
+	}
+	return ft.dataChunk.Read(int(n)).(Comparable)
+}
+
+// view returns the element associated with the node at index `n`, without
+// copying it; see chunk.View().
+//
+// It must only be used for comparisons: use data() to return an element.
+func (ft FreeTree) view(n uint32) Comparable {
+	if ft.codec != nil {
+		return ft.decode(n)
+	}
+	return ft.dataChunk.View(int(n))
+}
+
+// children returns the indices of the children of the node at index `n`.
+func (ft FreeTree) children(n uint32) (left, right uint32) {
+	if ft.layout == EytzingerLayout {
+		return ft.implicitNode(2*uint64(n) + 1), ft.implicitNode(2*uint64(n) + 2)
+	}
+	node := ft.node(n)
+	return node.left, node.right
+}
+
+// count returns the number of nodes in the subtree rooted at index `n`.
+func (ft FreeTree) count(n uint32) uint32 {
+	if n == noNode {
+		return 0
+	}
+	if ft.layout == EytzingerLayout {
+		return implicitCount(uint64(n), uint64(ft.slots))
+	}
+	return ft.node(n).size
 }
 
 // Ascend returns the first element in the tree that is == `pivot`.
 func (ft FreeTree) Ascend(pivot Comparable) Comparable {
+	ft.checkOpen()
 	return ft.ascend(pivot)
 }
 
 func (ft FreeTree) ascend(pivot Comparable) Comparable {
-	return ft.root.ascend(pivot, ft.dataChunk)
+	if n := ft.find(pivot); n != noNode {
+		return ft.data(n)
+	}
+	return nil
+}
+
+// Contains returns true if the tree holds an element that is == `pivot`.
+//
+// Contrary to Ascend(), it never allocates.
+func (ft FreeTree) Contains(pivot Comparable) bool {
+	ft.checkOpen()
+	return ft.find(pivot) != noNode
+}
+
+// Layout returns the memory layout used by the tree.
+func (ft FreeTree) Layout() Layout {
+	ft.checkOpen()
+	return ft.layout
+}
+
+// Len returns the number of elements in the tree.
+func (ft FreeTree) Len() int {
+	ft.checkOpen()
+	return int(ft.count(ft.root))
+}
+
+// Min returns the smallest element in the tree, or nil if the tree is empty.
+func (ft FreeTree) Min() Comparable {
+	return ft.Select(0)
+}
+
+// Max returns the greatest element in the tree, or nil if the tree is empty.
+func (ft FreeTree) Max() Comparable {
+	return ft.Select(ft.Len() - 1)
+}
+
+// Select returns the k-th smallest element in the tree (starting at 0), or
+// nil if `k` is out of bounds.
+//
+// It runs in O(h), h being the height of the tree.
+func (ft FreeTree) Select(k int) Comparable {
+	ft.checkOpen()
+	if k < 0 || k >= ft.Len() {
+		return nil
+	}
+	return ft.nth(uint32(k))
+}
+
+// Rank returns the number of elements in the tree that are < `pivot`; i.e.
+// the index `pivot` has or would have in the sorted content of the tree.
+//
+// It runs in O(h), h being the height of the tree.
+func (ft FreeTree) Rank(pivot Comparable) int {
+	ft.checkOpen()
+	return int(ft.rank(pivot, false))
+}
+
+// AscendEqual calls `visitor` on every element of the tree that is ==
+// `pivot`.
+// Iteration stops as soon as `visitor` returns false.
+func (ft *FreeTree) AscendEqual(pivot Comparable, visitor Visitor) {
+	ft.checkOpen()
+	ft.ascendEqual(pivot, visitor)
+}
+
+// Count returns the number of elements in the tree that are == `pivot`.
+//
+// It runs in O(h), h being the height of the tree.
+func (ft FreeTree) Count(pivot Comparable) int {
+	ft.checkOpen()
+	return int(ft.rank(pivot, true) - ft.rank(pivot, false))
+}
+
+// Floor returns the greatest element in the tree that is <= `pivot`, or nil if
+// there is none.
+func (ft FreeTree) Floor(pivot Comparable) Comparable {
+	ft.checkOpen()
+	return ft.nearest(pivot, true, true)
+}
+
+// Ceiling returns the smallest element in the tree that is >= `pivot`, or nil
+// if there is none.
+func (ft FreeTree) Ceiling(pivot Comparable) Comparable {
+	ft.checkOpen()
+	return ft.nearest(pivot, false, true)
+}
+
+// Predecessor returns the greatest element in the tree that is < `pivot`, or
+// nil if there is none.
+func (ft FreeTree) Predecessor(pivot Comparable) Comparable {
+	ft.checkOpen()
+	return ft.nearest(pivot, true, false)
 }
 
-// Flatten returns the content of the tree as a ComparableArray.
+// Successor returns the smallest element in the tree that is > `pivot`, or nil
+// if there is none.
+func (ft FreeTree) Successor(pivot Comparable) Comparable {
+	ft.checkOpen()
+	return ft.nearest(pivot, false, false)
+}
+
+// AscendRange calls `visitor` on every element `e` of the tree such that
+// `greaterOrEqual` <= `e` < `lessThan`, in increasing order.
+// Iteration stops as soon as `visitor` returns false.
+func (ft *FreeTree) AscendRange(greaterOrEqual, lessThan Comparable, visitor Visitor) {
+	ft.checkOpen()
+	ft.ascendRange(greaterOrEqual, lessThan, visitor)
+}
+
+// AscendGreaterOrEqual calls `visitor` on every element `e` of the tree such
+// that `e` >= `pivot`, in increasing order.
+// Iteration stops as soon as `visitor` returns false.
+func (ft *FreeTree) AscendGreaterOrEqual(pivot Comparable, visitor Visitor) {
+	ft.checkOpen()
+	ft.ascendRange(pivot, nil, visitor)
+}
+
+// DescendLessThan calls `visitor` on every element `e` of the tree such that
+// `e` < `pivot`, in decreasing order.
+// Iteration stops as soon as `visitor` returns false.
+func (ft *FreeTree) DescendLessThan(pivot Comparable, visitor Visitor) {
+	ft.checkOpen()
+	ft.descendRange(nil, pivot, visitor)
+}
+
+// Flatten returns the content of the tree as a ComparableArray, in PostOrder.
 func (ft FreeTree) Flatten() ComparableArray {
-	return ft.flatten()
+	ft.checkOpen()
+	return ft.flatten(PostOrder)
+}
+
+// FlattenOrder returns the content of the tree as a ComparableArray, using
+// the given traversal order.
+//
+// Use InOrder to get the elements sorted in increasing order.
+func (ft FreeTree) FlattenOrder(order TraversalOrder) ComparableArray {
+	ft.checkOpen()
+	return ft.flatten(order)
 }
 
-func (ft FreeTree) flatten() ComparableArray {
-	ca := make(ComparableArray, 0, ft.nodeChunk.NbObjects())
-	return ft.root.flatten(ca, ft.dataChunk)
+func (ft FreeTree) flatten(order TraversalOrder) ComparableArray {
+	ca := make(ComparableArray, 0, ft.Len())
+	switch order {
+	case PostOrder, InOrder, PreOrder:
+		ft.walk(ft.root, order, func(n uint32) {
+			ca = append(ca, ft.data(n))
+		})
+		return ca
+	case LevelOrder:
+		return ft.flattenLevels(ca)
+	}
+	panic(fmt.Sprintf("freetree: unknown traversal order: %v", order))
 }
 
 // Delete deletes the memory chunks associated with the tree.
+//
+// If the tree was opened with OpenFreeTree(), the underlying file is
+// unmapped.
+// Deleting a tree twice is a no-op; any other use of a deleted tree panics
+// with ErrClosed, or returns it.
+//
+// Use Remove() to remove a single element from the tree.
 func (ft *FreeTree) Delete() *FreeTree {
-	ft.root = nil
+	if ft.closed {
+		return nil
+	}
+	ft.closed = true
+	ft.root, ft.slots, ft.free = noNode, 0, noNode
 	ft.dataChunk.Delete()
 	ft.nodeChunk.Delete()
+	ft.arena.Delete()
+	if ft.mapping != nil {
+		munmap(ft.mapping)
+		ft.mapping = nil
+	}
 
 	return nil
 }
 
+// deleted returns true if the tree has been deleted.
+func (ft *FreeTree) deleted() bool {
+	return ft.closed
+}
+
+// checkOpen panics with ErrClosed if the tree has been deleted.
+func (ft FreeTree) checkOpen() {
+	if ft.closed {
+		panic(ErrClosed)
+	}
+}
+
 // -----------------------------------------------------------------------------
 
+// noNode is the index used to represent a missing node.
+const noNode uint32 = math.MaxUint32
+
+// freeNode is a node of a FreeTree.
+//
+// Nodes reference each other through their indices in the node chunk, which
+// are also the indices of their respective elements in the data chunk.
 type freeNode struct {
-	id          uint
-	left, right uintptr
+	left, right uint32 // indices of the children, or noNode
+	size        uint32 // number of nodes in the subtree rooted at this node
+	height      uint32 // height of the subtree rooted at this node
+}
+
+// find returns the index of the first node whose element is == `pivot`, or
+// noNode if there is none.
+func (ft FreeTree) find(pivot Comparable) uint32 {
+	if ft.layout == EytzingerLayout {
+		n := ft.lowerBound(pivot)
+		if n != noNode && pivot.Less(ft.view(n)) {
+			return noNode
+		}
+		return n
+	}
+
+	for n := ft.root; n != noNode; {
+		data := ft.view(n)
+		if pivot.Less(data) {
+			n, _ = ft.children(n)
+		} else if data.Less(pivot) {
+			_, n = ft.children(n)
+		} else {
+			return n
+		}
+	}
+
+	return noNode
+}
+
+func (ft FreeTree) nth(k uint32) Comparable {
+	for n := ft.root; n != noNode; {
+		left, right := ft.children(n)
+		if l := ft.count(left); k < l {
+			n = left
+		} else if k > l {
+			k -= l + 1
+			n = right
+		} else {
+			return ft.data(n)
+		}
+	}
+
+	return nil
+}
+
+// rank returns the number of elements in the tree that are < `pivot`, or <=
+// `pivot` if `orEqual` is true.
+func (ft FreeTree) rank(pivot Comparable, orEqual bool) uint32 {
+	var r uint32
+	for n := ft.root; n != noNode; {
+		left, right := ft.children(n)
+		data := ft.view(n)
+		if data.Less(pivot) || (orEqual && !pivot.Less(data)) {
+			r += ft.count(left) + 1
+			n = right
+		} else {
+			n = left
+		}
+	}
+
+	return r
 }
 
-func (sn *freeNode) ascend(pivot Comparable, dataChunk mmm.MemChunk) Comparable {
-	if sn == nil {
+// nearest returns the greatest element of the tree that is < `pivot` if
+// `below` is true, or the smallest element that is > `pivot` otherwise.
+// If `orEqual` is true, an element == `pivot` is returned as soon as it is
+// found.
+func (ft FreeTree) nearest(pivot Comparable, below, orEqual bool) Comparable {
+	best := noNode
+	for n := ft.root; n != noNode; {
+		left, right := ft.children(n)
+		data := ft.view(n)
+		if data.Less(pivot) {
+			if below {
+				best = n
+			}
+			n = right
+		} else if pivot.Less(data) {
+			if !below {
+				best = n
+			}
+			n = left
+		} else if orEqual {
+			return ft.data(n)
+		} else if below {
+			n = left
+		} else {
+			n = right
+		}
+	}
+
+	if best == noNode {
 		return nil
 	}
+	return ft.data(best)
+}
 
-	data := dataChunk.Read(int(sn.id)).(Comparable)
-	if pivot.Less(data) {
-		return ((*freeNode)(unsafe.Pointer(sn.left))).ascend(pivot, dataChunk)
-	} else if data.Less(pivot) {
-		return ((*freeNode)(unsafe.Pointer(sn.right))).ascend(pivot, dataChunk)
+// ascendRange visits, in increasing order, every element `e` of the tree
+// such that `lo` <= `e` < `hi`; a nil bound means unbounded.
+func (ft *FreeTree) ascendRange(lo, hi Comparable, visitor Visitor) {
+	it := ft.Iterator()
+	if lo == nil {
+		it.First()
+	} else {
+		it.Seek(lo)
 	}
+	for ; it.Valid(); it.Next() {
+		n := it.top()
+		if (hi != nil && !ft.view(n).Less(hi)) || !visitor(ft.data(n)) {
+			return
+		}
+	}
+}
 
-	return data
+// ascendEqual visits, in increasing order, every element of the tree that is
+// == `pivot`.
+func (ft *FreeTree) ascendEqual(pivot Comparable, visitor Visitor) {
+	it := ft.Iterator()
+	for it.Seek(pivot); it.Valid(); it.Next() {
+		n := it.top()
+		if pivot.Less(ft.view(n)) || !visitor(ft.data(n)) {
+			return
+		}
+	}
 }
 
-func (sn *freeNode) flatten(ca ComparableArray, dataChunk mmm.MemChunk) ComparableArray {
-	if sn == nil {
+// descendRange visits, in decreasing order, every element `e` of the tree
+// such that `lo` <= `e` < `hi`; a nil bound means unbounded.
+func (ft *FreeTree) descendRange(lo, hi Comparable, visitor Visitor) {
+	it := ft.Iterator()
+	if hi == nil {
+		it.Last()
+	} else {
+		it.seekBefore(hi)
+	}
+	for ; it.Valid(); it.Prev() {
+		n := it.top()
+		if (lo != nil && ft.view(n).Less(lo)) || !visitor(ft.data(n)) {
+			return
+		}
+	}
+}
+
+// walk calls `visit` on every node of the subtree rooted at index `n`, using
+// the given depth-first traversal order.
+//
+// The traversal uses an explicit stack: its memory usage is proportional to
+// the height of the tree, but it never grows the goroutine's stack.
+func (ft FreeTree) walk(n uint32, order TraversalOrder, visit func(n uint32)) {
+	if n == noNode {
+		return
+	}
+
+	stack := make([]uint32, 0, iteratorDepth)
+	switch order {
+	case PreOrder:
+		stack = append(stack, n)
+		for len(stack) > 0 {
+			n = stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			visit(n)
+			left, right := ft.children(n)
+			if right != noNode {
+				stack = append(stack, right)
+			}
+			if left != noNode {
+				stack = append(stack, left)
+			}
+		}
+	case InOrder:
+		for n != noNode || len(stack) > 0 {
+			for ; n != noNode; n, _ = ft.children(n) {
+				stack = append(stack, n)
+			}
+			n = stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			visit(n)
+			_, n = ft.children(n)
+		}
+	case PostOrder:
+		last := noNode
+		for n != noNode || len(stack) > 0 {
+			if n != noNode {
+				stack = append(stack, n)
+				n, _ = ft.children(n)
+				continue
+			}
+			top := stack[len(stack)-1]
+			if _, right := ft.children(top); right != noNode && right != last {
+				n = right
+			} else {
+				visit(top)
+				last = top
+				stack = stack[:len(stack)-1]
+			}
+		}
+	}
+}
+
+func (ft FreeTree) flattenLevels(ca ComparableArray) ComparableArray {
+	if ft.root == noNode {
 		return ca
 	}
 
-	ca = ((*freeNode)(unsafe.Pointer(sn.left))).flatten(ca, dataChunk)
-	ca = ((*freeNode)(unsafe.Pointer(sn.right))).flatten(ca, dataChunk)
+	queue := []uint32{ft.root}
+	for len(queue) > 0 {
+		n := queue[0]
+		queue = queue[1:]
+		ca = append(ca, ft.data(n))
+		left, right := ft.children(n)
+		if left != noNode {
+			queue = append(queue, left)
+		}
+		if right != noNode {
+			queue = append(queue, right)
+		}
+	}
 
-	return append(ca, dataChunk.Read(int(sn.id)).(Comparable))
+	return ca
 }
@@ -7,7 +7,9 @@ package freetree
 
 import (
 	"fmt"
+	"io"
 	"log"
+	"runtime/debug"
 	"testing"
 )
 
@@ -176,6 +178,347 @@ func TestFreeTree_pair_unsorted_input_rebalanced(t *testing.T) {
 	}
 }
 
+func TestFreeTree_empty(t *testing.T) {
+	ft, err := NewFreeTree(NewSimpleTree())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ft.Delete()
+
+	if ft.Ascend(intTest(1)) != nil || ft.Len() != 0 || ft.Min() != nil || ft.Max() != nil ||
+		ft.Rank(intTest(1)) != 0 || ft.Count(intTest(1)) != 0 || ft.Floor(intTest(1)) != nil {
+		t.Error("unexpected retval")
+	}
+	for _, order := range []TraversalOrder{PostOrder, InOrder, PreOrder, LevelOrder} {
+		if flat := ft.FlattenOrder(order); flat == nil || len(flat) != 0 {
+			t.Errorf("%v: expected an empty array, got %v", order, flat)
+		}
+	}
+	var ca ComparableArray
+	ft.AscendRange(nil, nil, collect(&ca, -1))
+	ft.DescendLessThan(intTest(1), collect(&ca, -1))
+	it := ft.Iterator()
+	if it.First(); it.Valid() || len(ca) != 0 {
+		t.Error("unexpected element")
+	}
+	if removed, err := ft.Remove(intTest(1)); removed || err != nil || ft.Rebalance() != nil {
+		t.Error("unexpected retval")
+	}
+
+	// an empty tree can still be filled
+	if err := ft.Insert(intTest(1)); err != nil {
+		t.Fatal(err)
+	}
+	if ft.Len() != 1 || ft.Ascend(intTest(1)) != intTest(1) {
+		t.Error("unexpected retval")
+	}
+}
+
+func TestFreeTree_traversal_orders(t *testing.T) {
+	expected := map[TraversalOrder]ComparableArray{
+		PostOrder:  {intTest(1), intTest(3), intTest(2), intTest(5), intTest(6), intTest(4)},
+		InOrder:    {intTest(1), intTest(2), intTest(3), intTest(4), intTest(5), intTest(6)},
+		PreOrder:   {intTest(4), intTest(2), intTest(1), intTest(3), intTest(6), intTest(5)},
+		LevelOrder: {intTest(4), intTest(2), intTest(6), intTest(1), intTest(3), intTest(5)},
+	}
+
+	st := NewSimpleTree()
+	cs := ComparableArray{intTest(5), intTest(4), intTest(6), intTest(1), intTest(3), intTest(2)}
+
+	st.InsertArray(cs)
+
+	ft, err := NewFreeTree(st.Rebalance())
+	if err != nil {
+		t.Error(err)
+	}
+	defer ft.Delete()
+
+	for order, exp := range expected {
+		flat := ft.FlattenOrder(order)
+		if len(flat) != len(exp) {
+			t.Errorf("%v: expected != flat", order)
+			continue
+		}
+		for i := range exp {
+			if flat[i] != exp[i] {
+				t.Errorf("%v: expected != flat", order)
+				break
+			}
+		}
+	}
+}
+
+func TestFreeTree_range_queries(t *testing.T) {
+	st := NewSimpleTree()
+	cs := ComparableArray{intTest(5), intTest(4), intTest(6), intTest(1), intTest(3), intTest(2)}
+
+	st.InsertArray(cs)
+
+	ft, err := NewFreeTree(st)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ft.Delete()
+
+	var ca ComparableArray
+	ft.AscendRange(intTest(2), intTest(5), collect(&ca, -1))
+	checkArray(t, "AscendRange", ComparableArray{intTest(2), intTest(3), intTest(4)}, ca)
+
+	ca = nil
+	ft.AscendRange(intTest(0), intTest(100), collect(&ca, 2))
+	checkArray(t, "AscendRange (early stop)", ComparableArray{intTest(1), intTest(2)}, ca)
+
+	ca = nil
+	ft.AscendRange(intTest(4), intTest(4), collect(&ca, -1))
+	checkArray(t, "AscendRange (empty)", ComparableArray{}, ca)
+
+	ca = nil
+	ft.AscendGreaterOrEqual(intTest(4), collect(&ca, -1))
+	checkArray(t, "AscendGreaterOrEqual", ComparableArray{intTest(4), intTest(5), intTest(6)}, ca)
+
+	ca = nil
+	ft.AscendGreaterOrEqual(intTest(3), collect(&ca, 2))
+	checkArray(t, "AscendGreaterOrEqual (early stop)", ComparableArray{intTest(3), intTest(4)}, ca)
+
+	ca = nil
+	ft.DescendLessThan(intTest(4), collect(&ca, -1))
+	checkArray(t, "DescendLessThan", ComparableArray{intTest(3), intTest(2), intTest(1)}, ca)
+
+	ca = nil
+	ft.DescendLessThan(intTest(7), collect(&ca, 4))
+	checkArray(t, "DescendLessThan (early stop)", ComparableArray{intTest(6), intTest(5), intTest(4), intTest(3)}, ca)
+}
+
+func TestFreeTree_nearest(t *testing.T) {
+	st := NewSimpleTree()
+	cs := ComparableArray{intTest(8), intTest(2), intTest(10), intTest(6), intTest(4)}
+
+	st.InsertArray(cs)
+
+	ft, err := NewFreeTree(st)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ft.Delete()
+
+	for _, nt := range nearestTests {
+		if c := ft.Floor(nt.pivot); c != nt.floor {
+			t.Errorf("Floor(%v): expected %v, got %v", nt.pivot, nt.floor, c)
+		}
+		if c := ft.Ceiling(nt.pivot); c != nt.ceiling {
+			t.Errorf("Ceiling(%v): expected %v, got %v", nt.pivot, nt.ceiling, c)
+		}
+		if c := ft.Predecessor(nt.pivot); c != nt.predecessor {
+			t.Errorf("Predecessor(%v): expected %v, got %v", nt.pivot, nt.predecessor, c)
+		}
+		if c := ft.Successor(nt.pivot); c != nt.successor {
+			t.Errorf("Successor(%v): expected %v, got %v", nt.pivot, nt.successor, c)
+		}
+	}
+}
+
+func TestFreeTree_order_statistics(t *testing.T) {
+	st := NewSimpleTree()
+	cs := ComparableArray{intTest(8), intTest(2), intTest(10), intTest(6), intTest(4)}
+
+	st.InsertArray(cs)
+
+	ft, err := NewFreeTree(st)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ft.Delete()
+
+	if ft.Len() != 5 {
+		t.Error("unexpected retval")
+	}
+	if ft.Min() != intTest(2) {
+		t.Error("unexpected retval")
+	}
+	if ft.Max() != intTest(10) {
+		t.Error("unexpected retval")
+	}
+
+	for k, exp := range ft.FlattenOrder(InOrder) {
+		if c := ft.Select(k); c != exp {
+			t.Errorf("Select(%d): expected %v, got %v", k, exp, c)
+		}
+		if r := ft.Rank(exp); r != k {
+			t.Errorf("Rank(%v): expected %d, got %d", exp, k, r)
+		}
+	}
+	if ft.Select(-1) != nil || ft.Select(5) != nil {
+		t.Error("unexpected retval")
+	}
+
+	ranks := map[intTest]int{1: 0, 3: 1, 7: 3, 11: 5}
+	for pivot, exp := range ranks {
+		if r := ft.Rank(pivot); r != exp {
+			t.Errorf("Rank(%v): expected %d, got %d", pivot, exp, r)
+		}
+	}
+}
+
+func TestFreeTree_lookup_allocs(t *testing.T) {
+	for _, layout := range []Layout{PointerLayout, EytzingerLayout} {
+		ft := buildLayout(t, layout, 1000, 3)
+		pivots := ComparableArray{intTest(0), intTest(300), intTest(301), intTest(2997), intTest(5000)}
+
+		if !ft.Contains(pivots[1]) || ft.Contains(pivots[2]) {
+			t.Errorf("%v: unexpected retval", layout)
+		}
+
+		it := ft.Iterator()
+		allocs := testing.AllocsPerRun(100, func() {
+			for _, pivot := range pivots {
+				ft.Contains(pivot)
+				ft.Rank(pivot)
+				ft.Count(pivot)
+				it.Seek(pivot)
+			}
+		})
+		if allocs != 0 {
+			t.Errorf("%v: unexpected allocations: %v", layout, allocs)
+		}
+
+		// only the returned copy is allocated
+		allocs = testing.AllocsPerRun(100, func() {
+			ft.Ascend(pivots[1])
+		})
+		if allocs > 1 {
+			t.Errorf("%v: unexpected allocations: %v", layout, allocs)
+		}
+
+		// range queries only allocate the copies they pass to the visitor
+		first := func(Comparable) bool { return false }
+		allocs = testing.AllocsPerRun(100, func() {
+			ft.AscendRange(pivots[1], nil, first)
+			ft.AscendGreaterOrEqual(pivots[1], first)
+			ft.AscendEqual(pivots[1], first)
+			ft.DescendLessThan(pivots[1], first)
+		})
+		if allocs > 4 {
+			t.Errorf("%v: unexpected allocations: %v", layout, allocs)
+		}
+		none := func(Comparable) bool { return true }
+		allocs = testing.AllocsPerRun(100, func() {
+			ft.AscendRange(pivots[1], pivots[1], none)
+			ft.AscendGreaterOrEqual(pivots[4], none)
+			ft.AscendEqual(pivots[2], none)
+			ft.DescendLessThan(pivots[0], none)
+		})
+		if allocs != 0 {
+			t.Errorf("%v: unexpected allocations: %v", layout, allocs)
+		}
+		ft.Delete()
+	}
+}
+
+func TestFreeTree_degenerate(t *testing.T) {
+	// recursing over a million nodes would need way more than that
+	defer debug.SetMaxStack(debug.SetMaxStack(1 << 20))
+
+	const n = 1000000
+	ft, err := NewFreeTree(degenerateTree(n))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ft.Delete()
+
+	checkSequence(t, "InOrder", ft.FlattenOrder(InOrder), 0, n, false)
+	checkSequence(t, "PreOrder", ft.FlattenOrder(PreOrder), 0, n, false)
+	checkSequence(t, "PostOrder", ft.FlattenOrder(PostOrder), n-1, n, true)
+	if ft.Ascend(intTest(n-1)) != intTest(n-1) || ft.Count(intTest(n-2)) != 1 {
+		t.Error("unexpected retval")
+	}
+
+	var ca ComparableArray
+	ft.AscendRange(intTest(n-3), intTest(n), collect(&ca, -1))
+	checkSequence(t, "AscendRange", ca, n-3, 3, false)
+	ca = ca[:0]
+	ft.DescendLessThan(intTest(n-1), collect(&ca, 2))
+	checkSequence(t, "DescendLessThan", ca, n-2, 2, true)
+
+	it := ft.Iterator()
+	if it.Last(); it.Value() != intTest(n-1) {
+		t.Error("Last: unexpected retval")
+	}
+	if it.Seek(intTest(n - 2)); it.Value() != intTest(n-2) {
+		t.Error("Seek: unexpected retval")
+	}
+
+	if err := ft.Insert(intTest(n)); err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []Comparable{intTest(n - 1), intTest(0)} {
+		if removed, err := ft.Remove(c); err != nil || !removed {
+			t.Errorf("Remove(%v): unexpected retval: %v, %v", c, removed, err)
+		}
+	}
+	if err := ft.Rebalance(); err != nil {
+		t.Fatal(err)
+	}
+	checkBalanced(t, ft, ft.root)
+	ca = ft.FlattenOrder(InOrder)
+	checkSequence(t, "Rebalance", ca[:len(ca)-1], 1, n-2, false)
+	if len(ca) != n-1 || ca[len(ca)-1] != intTest(n) {
+		t.Error("Insert: unexpected retval")
+	}
+}
+
+func TestFreeTree_use_after_delete(t *testing.T) {
+	ft, err := NewFreeTreeFromSorted(ComparableArray{intTest(1), intTest(2), intTest(3)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	it := ft.Iterator()
+	it.First()
+	ft.Delete()
+	ft.Delete() // no-op
+
+	for name, use := range map[string]func(){
+		"Ascend":      func() { ft.Ascend(intTest(2)) },
+		"Len":         func() { ft.Len() },
+		"Max":         func() { ft.Max() },
+		"AscendRange": func() { ft.AscendRange(nil, nil, collect(new(ComparableArray), -1)) },
+		"Flatten":     func() { ft.Flatten() },
+		"Iterator":    func() { ft.Iterator() },
+		"Next":        func() { it.Next() },
+	} {
+		checkClosed(t, name, use)
+	}
+	if err := ft.Insert(intTest(4)); err != ErrClosed {
+		t.Errorf("Insert: expected ErrClosed, got %v", err)
+	}
+	if _, err := ft.Remove(intTest(2)); err != ErrClosed {
+		t.Errorf("Remove: expected ErrClosed, got %v", err)
+	}
+	if err := ft.Rebalance(); err != ErrClosed {
+		t.Errorf("Rebalance: expected ErrClosed, got %v", err)
+	}
+	if _, err := ft.WriteTo(io.Discard); err != ErrClosed {
+		t.Errorf("WriteTo: expected ErrClosed, got %v", err)
+	}
+
+	// resolving a node index must not dereference freed memory
+	defer func() {
+		if r := recover(); r != "freetree: use of a deleted chunk" {
+			t.Errorf("unexpected panic: %v", r)
+		}
+	}()
+	ft.node(1)
+}
+
+// checkClosed checks that `use` panics with ErrClosed.
+func checkClosed(t *testing.T, name string, use func()) {
+	defer func() {
+		if r := recover(); r != ErrClosed {
+			t.Errorf("%s: expected ErrClosed, got %v", name, r)
+		}
+	}()
+	use()
+}
+
 // -----------------------------------------------------------------------------
 
 type Int int
@@ -199,6 +542,8 @@ func Example_simple_usage() {
 
 	// print [17 66 42]
 	fmt.Println(st.Flatten())
+	// print [17 42 66]
+	fmt.Println(st.FlattenOrder(InOrder))
 
 	// build a new FreeTree using the data from the SimpleTree
 	ft, err := NewFreeTree(st)
@@ -216,6 +561,8 @@ func Example_simple_usage() {
 
 	// print [17 66 42]
 	fmt.Println(ft.Flatten())
+	// print [17 42 66]
+	fmt.Println(ft.FlattenOrder(InOrder))
 
 	// delete the FreeTree
 	ft.Delete()
@@ -225,7 +572,29 @@ func Example_simple_usage() {
 	// <nil>
 	// [42 17 66]
 	// [17 66 42]
+	// [17 42 66]
 	// 42
 	// <nil>
 	// [17 66 42]
+	// [17 42 66]
+}
+
+// -----------------------------------------------------------------------------
+
+func BenchmarkFreeTree_Ascend(b *testing.B) {
+	ints := make(ComparableArray, 1e6)
+	for i := range ints {
+		ints[i] = Int(i)
+	}
+	ft, err := NewFreeTree(NewSimpleTree().InsertArray(ints))
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer ft.Delete()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		ft.Ascend(ints[i%len(ints)])
+	}
 }
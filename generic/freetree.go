@@ -0,0 +1,204 @@
+// Copyright © 2015 Clement 'cmc' Rey <cr.rey.clement@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.21
+
+// Package generic implements a type-parameterized FreeTree.
+//
+// It uses the same zero-GC, off-heap layout as freetree.FreeTree, but values
+// are never boxed into interfaces: they are compared in place, as typed
+// pointers into the data chunk.
+package generic
+
+import (
+	"cmp"
+	"errors"
+	"math"
+	"slices"
+	"unsafe"
+
+	"github.com/teh-cmc/mmm"
+)
+
+// -----------------------------------------------------------------------------
+
+// ErrTooLarge is returned when trying to build a FreeTree with more than
+// math.MaxUint32 - 1 elements.
+var ErrTooLarge = errors.New("generic: too many elements")
+
+// FreeTree implements a binary search tree of `T`s with zero GC overhead.
+//
+// `T` must not contain any pointer (see mmm.NewMemChunk for a list of
+// supported types).
+type FreeTree[T any] struct {
+	cmp       func(a, b T) int
+	nodeChunk mmm.MemChunk
+	dataChunk mmm.MemChunk
+	root      uint32
+	len       int
+}
+
+// NewFreeTree returns a new FreeTree containing a copy of `values`.
+//
+// `cmp` must return a negative number if `a` < `b`, a positive number if
+// `a` > `b` and zero if `a` == `b`.
+// `values` don't need to be sorted and are left untouched: they are copied
+// then sorted directly in the off-heap data chunk, so the resulting tree is
+// always perfectly balanced.
+func NewFreeTree[T any](values []T, cmp func(a, b T) int) (*FreeTree[T], error) {
+	ft := &FreeTree[T]{cmp: cmp, root: noNode, len: len(values)}
+	if ft.len == 0 {
+		return ft, nil
+	}
+	if ft.len >= math.MaxUint32 {
+		return nil, ErrTooLarge
+	}
+
+	var zero T
+	nodeChunk, err := mmm.NewMemChunk(freeNode{}, uint(ft.len))
+	if err != nil {
+		return nil, err
+	}
+	dataChunk, err := mmm.NewMemChunk(zero, uint(ft.len))
+	if err != nil {
+		nodeChunk.Delete()
+		return nil, err
+	}
+	ft.nodeChunk, ft.dataChunk = nodeChunk, dataChunk
+
+	data := ft.data()
+	copy(data, values)
+	slices.SortFunc(data, cmp)
+
+	ft.root = ft.build(0, uint32(ft.len))
+
+	return ft, nil
+}
+
+// NewOrderedFreeTree returns a new FreeTree containing a copy of `values`,
+// ordered using cmp.Compare.
+func NewOrderedFreeTree[T cmp.Ordered](values []T) (*FreeTree[T], error) {
+	return NewFreeTree(values, cmp.Compare[T])
+}
+
+// build sets up the nodes for the sorted data in [lo, hi) and returns the
+// index of the root of the resulting subtree.
+//
+// Node i always points to the i-th smallest value of the data chunk.
+func (ft *FreeTree[T]) build(lo, hi uint32) uint32 {
+	if lo >= hi {
+		return noNode
+	}
+
+	mid := lo + (hi-lo)/2
+	node := ft.node(mid)
+	node.left = ft.build(lo, mid)
+	node.right = ft.build(mid+1, hi)
+
+	return mid
+}
+
+// data returns the content of the data chunk as a slice.
+//
+// The returned slice points to off-heap memory: it must not be used once the
+// tree has been deleted.
+func (ft FreeTree[T]) data() []T {
+	if ft.len == 0 {
+		return nil
+	}
+	return unsafe.Slice((*T)(unsafe.Pointer(ft.dataChunk.Pointer(0))), ft.len)
+}
+
+// node returns the node at index `n` in the node chunk.
+func (ft FreeTree[T]) node(n uint32) *freeNode {
+	return (*freeNode)(unsafe.Pointer(ft.nodeChunk.Pointer(int(n))))
+}
+
+// value returns a pointer to the value associated with the node at index `n`.
+func (ft FreeTree[T]) value(n uint32) *T {
+	return (*T)(unsafe.Pointer(ft.dataChunk.Pointer(int(n))))
+}
+
+// Len returns the number of elements in the tree.
+func (ft FreeTree[T]) Len() int {
+	return ft.len
+}
+
+// Ascend returns the first element in the tree that is == `pivot`.
+// The boolean is false if there is no such element.
+func (ft FreeTree[T]) Ascend(pivot T) (T, bool) {
+	for n := ft.root; n != noNode; {
+		v := ft.value(n)
+		switch c := ft.cmp(pivot, *v); {
+		case c < 0:
+			n = ft.node(n).left
+		case c > 0:
+			n = ft.node(n).right
+		default:
+			return *v, true
+		}
+	}
+
+	var zero T
+	return zero, false
+}
+
+// AscendRange calls `visitor` on every element `e` of the tree such that
+// `greaterOrEqual` <= `e` < `lessThan`, in increasing order.
+// Iteration stops as soon as `visitor` returns false.
+func (ft FreeTree[T]) AscendRange(greaterOrEqual, lessThan T, visitor func(v T) bool) {
+	ft.ascendRange(ft.root, greaterOrEqual, lessThan, visitor)
+}
+
+func (ft FreeTree[T]) ascendRange(n uint32, lo, hi T, visitor func(v T) bool) bool {
+	if n == noNode {
+		return true
+	}
+
+	node, v := ft.node(n), ft.value(n)
+	if ft.cmp(*v, lo) >= 0 {
+		if !ft.ascendRange(node.left, lo, hi, visitor) {
+			return false
+		}
+		if ft.cmp(*v, hi) < 0 && !visitor(*v) {
+			return false
+		}
+	}
+	if ft.cmp(*v, hi) < 0 {
+		return ft.ascendRange(node.right, lo, hi, visitor)
+	}
+
+	return true
+}
+
+// Flatten returns a copy of the content of the tree, in increasing order.
+func (ft FreeTree[T]) Flatten() []T {
+	return slices.Clone(ft.data())
+}
+
+// Delete deletes the memory chunks associated with the tree.
+func (ft *FreeTree[T]) Delete() *FreeTree[T] {
+	if ft.root != noNode {
+		ft.root = noNode
+		ft.dataChunk.Delete()
+		ft.nodeChunk.Delete()
+	}
+	ft.len = 0
+
+	return nil
+}
+
+// -----------------------------------------------------------------------------
+
+// noNode is the index used to represent a missing node.
+const noNode uint32 = math.MaxUint32
+
+// freeNode is a node of a FreeTree.
+//
+// Nodes reference each other through their indices in the node chunk, which
+// are also the indices of their respective values in the data chunk.
+type freeNode struct {
+	left, right uint32 // indices of the children, or noNode
+}
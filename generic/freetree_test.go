@@ -0,0 +1,133 @@
+// Copyright © 2015 Clement 'cmc' Rey <cr.rey.clement@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.21
+
+package generic
+
+import (
+	"slices"
+	"testing"
+)
+
+// -----------------------------------------------------------------------------
+
+func TestFreeTree_unsorted_input(t *testing.T) {
+	values := []int{5, 4, 6, 1, 3, 2}
+
+	ft, err := NewOrderedFreeTree(values)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ft.Delete()
+
+	if !slices.Equal(values, []int{5, 4, 6, 1, 3, 2}) {
+		t.Error("input was modified")
+	}
+	if flat := ft.Flatten(); !slices.Equal(flat, []int{1, 2, 3, 4, 5, 6}) {
+		t.Errorf("unexpected flat: %v", flat)
+	}
+	if ft.Len() != 6 {
+		t.Error("unexpected retval")
+	}
+
+	for _, v := range values {
+		if c, ok := ft.Ascend(v); !ok || c != v {
+			t.Error("unexpected retval")
+		}
+	}
+	if _, ok := ft.Ascend(7); ok {
+		t.Error("unexpected retval")
+	}
+	if _, ok := ft.Ascend(0); ok {
+		t.Error("unexpected retval")
+	}
+
+	var visited []int
+	ft.AscendRange(2, 5, func(v int) bool {
+		visited = append(visited, v)
+		return true
+	})
+	if !slices.Equal(visited, []int{2, 3, 4}) {
+		t.Errorf("unexpected range: %v", visited)
+	}
+}
+
+type point struct{ x, y int32 }
+
+func TestFreeTree_custom_cmp(t *testing.T) {
+	byX := func(a, b point) int { return int(a.x - b.x) }
+	values := []point{{3, 30}, {1, 10}, {2, 20}}
+
+	ft, err := NewFreeTree(values, byX)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ft.Delete()
+
+	if p, ok := ft.Ascend(point{x: 2}); !ok || p.y != 20 {
+		t.Error("unexpected retval")
+	}
+}
+
+func TestFreeTree_empty(t *testing.T) {
+	ft, err := NewOrderedFreeTree([]int(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := ft.Ascend(1); ok {
+		t.Error("unexpected retval")
+	}
+	if len(ft.Flatten()) != 0 || ft.Len() != 0 {
+		t.Error("unexpected retval")
+	}
+	ft.Delete()
+}
+
+func TestFreeTree_pointers_rejected(t *testing.T) {
+	if _, err := NewOrderedFreeTree([]string{"a"}); err == nil {
+		t.Error("expected error")
+	}
+}
+
+func TestFreeTree_Ascend_allocs(t *testing.T) {
+	values := make([]int, 1000)
+	for i := range values {
+		values[i] = i
+	}
+	ft, err := NewOrderedFreeTree(values)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ft.Delete()
+
+	allocs := testing.AllocsPerRun(100, func() {
+		if _, ok := ft.Ascend(666); !ok {
+			t.Error("unexpected retval")
+		}
+	})
+	if allocs != 0 {
+		t.Errorf("expected 0 allocs, got %v", allocs)
+	}
+}
+
+func BenchmarkFreeTree_Ascend(b *testing.B) {
+	values := make([]int, 1e6)
+	for i := range values {
+		values[i] = i
+	}
+	ft, err := NewOrderedFreeTree(values)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer ft.Delete()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		ft.Ascend(i % len(values))
+	}
+}
@@ -0,0 +1,356 @@
+// Copyright © 2015 Clement 'cmc' Rey <cr.rey.clement@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package freetree
+
+// -----------------------------------------------------------------------------
+
+/////
+// Iterators
+//
+// Iterators keep track of the path from the root of the tree to their
+// current node in a fixed-size array: as long as the tree is at most
+// iteratorDepth levels high, which any balanced tree is, moving an iterator
+// around never allocates.
+// Deeper paths spill over to a slice that is reused for the lifetime of the
+// iterator.
+//
+// An iterator must not be used once its tree has been modified.
+/////
+
+// iteratorDepth is the height of the trees up to which iterators never
+// allocate.
+const iteratorDepth = 64
+
+// Iterator is a pull-style iterator over the elements of a FreeTree, in
+// increasing order.
+//
+// A new iterator is invalid: it must first be positioned using First(),
+// Last() or Seek().
+type Iterator struct {
+	ft    *FreeTree
+	path  [iteratorDepth]uint32
+	spill []uint32 // nodes deeper than iteratorDepth
+	depth int
+}
+
+// Iterator returns a new, unpositioned, Iterator over the tree.
+func (ft *FreeTree) Iterator() Iterator {
+	ft.checkOpen()
+	return Iterator{ft: ft}
+}
+
+// Valid returns true if the iterator is positioned on an element.
+func (it *Iterator) Valid() bool {
+	return it.depth > 0
+}
+
+// Value returns the element the iterator is positioned on, or nil if the
+// iterator is not valid.
+func (it *Iterator) Value() Comparable {
+	it.ft.checkOpen()
+	if it.depth == 0 {
+		return nil
+	}
+	return it.ft.data(it.top())
+}
+
+// First positions the iterator on the smallest element of the tree.
+func (it *Iterator) First() {
+	it.ft.checkOpen()
+	it.depth = 0
+	it.descend(it.ft.root, true)
+}
+
+// Last positions the iterator on the greatest element of the tree.
+func (it *Iterator) Last() {
+	it.ft.checkOpen()
+	it.depth = 0
+	it.descend(it.ft.root, false)
+}
+
+// Seek positions the iterator on the smallest element of the tree that is >=
+// `pivot`; the iterator is invalid if there is none.
+func (it *Iterator) Seek(pivot Comparable) {
+	it.ft.checkOpen()
+	it.depth = 0
+	found := 0
+	for n := it.ft.root; n != noNode; {
+		it.push(n)
+		left, right := it.ft.children(n)
+		if it.ft.view(n).Less(pivot) {
+			n = right
+		} else {
+			found = it.depth
+			n = left
+		}
+	}
+	it.depth = found
+}
+
+// seekBefore positions the iterator on the greatest element of the tree that
+// is < `pivot`; the iterator is invalid if there is none.
+func (it *Iterator) seekBefore(pivot Comparable) {
+	it.depth = 0
+	found := 0
+	for n := it.ft.root; n != noNode; {
+		it.push(n)
+		left, right := it.ft.children(n)
+		if it.ft.view(n).Less(pivot) {
+			found = it.depth
+			n = right
+		} else {
+			n = left
+		}
+	}
+	it.depth = found
+}
+
+// Next moves the iterator to the next element; the iterator becomes invalid
+// if there is none.
+func (it *Iterator) Next() {
+	it.ft.checkOpen()
+	if it.depth == 0 {
+		return
+	}
+
+	if _, right := it.ft.children(it.top()); right != noNode {
+		it.descend(right, true)
+		return
+	}
+	// go up until we come from a left child
+	for {
+		child := it.pop()
+		if it.depth == 0 {
+			return
+		}
+		if _, right := it.ft.children(it.top()); right != child {
+			return
+		}
+	}
+}
+
+// Prev moves the iterator to the previous element; the iterator becomes
+// invalid if there is none.
+func (it *Iterator) Prev() {
+	it.ft.checkOpen()
+	if it.depth == 0 {
+		return
+	}
+
+	if left, _ := it.ft.children(it.top()); left != noNode {
+		it.descend(left, false)
+		return
+	}
+	// go up until we come from a right child
+	for {
+		child := it.pop()
+		if it.depth == 0 {
+			return
+		}
+		if left, _ := it.ft.children(it.top()); left != child {
+			return
+		}
+	}
+}
+
+// descend pushes the node at index `n`, then its leftmost (or rightmost)
+// descendants.
+func (it *Iterator) descend(n uint32, leftmost bool) {
+	for n != noNode {
+		it.push(n)
+		left, right := it.ft.children(n)
+		if leftmost {
+			n = left
+		} else {
+			n = right
+		}
+	}
+}
+
+func (it *Iterator) push(n uint32) {
+	if it.depth < iteratorDepth {
+		it.path[it.depth] = n
+	} else if i := it.depth - iteratorDepth; i < len(it.spill) {
+		it.spill[i] = n
+	} else {
+		it.spill = append(it.spill, n)
+	}
+	it.depth++
+}
+
+func (it *Iterator) pop() uint32 {
+	n := it.top()
+	it.depth--
+	return n
+}
+
+func (it *Iterator) top() uint32 {
+	if i := it.depth - 1; i < iteratorDepth {
+		return it.path[i]
+	}
+	return it.spill[it.depth-1-iteratorDepth]
+}
+
+// -----------------------------------------------------------------------------
+
+// SimpleIterator is a pull-style iterator over the elements of a SimpleTree,
+// in increasing order.
+//
+// A new iterator is invalid: it must first be positioned using First(),
+// Last() or Seek().
+type SimpleIterator struct {
+	st    *SimpleTree
+	path  [iteratorDepth]*simpleNode
+	spill []*simpleNode // nodes deeper than iteratorDepth
+	depth int
+}
+
+// Iterator returns a new, unpositioned, SimpleIterator over the tree.
+func (st *SimpleTree) Iterator() SimpleIterator {
+	return SimpleIterator{st: st}
+}
+
+// Valid returns true if the iterator is positioned on an element.
+func (it *SimpleIterator) Valid() bool {
+	return it.depth > 0
+}
+
+// Value returns the element the iterator is positioned on, or nil if the
+// iterator is not valid.
+func (it *SimpleIterator) Value() Comparable {
+	if it.depth == 0 {
+		return nil
+	}
+	return it.top().data
+}
+
+// First positions the iterator on the smallest element of the tree.
+func (it *SimpleIterator) First() {
+	it.depth = 0
+	it.descend(it.st.root, true)
+}
+
+// Last positions the iterator on the greatest element of the tree.
+func (it *SimpleIterator) Last() {
+	it.depth = 0
+	it.descend(it.st.root, false)
+}
+
+// Seek positions the iterator on the smallest element of the tree that is >=
+// `pivot`; the iterator is invalid if there is none.
+func (it *SimpleIterator) Seek(pivot Comparable) {
+	it.depth = 0
+	found := 0
+	for n := it.st.root; n != nil; {
+		it.push(n)
+		if n.data.Less(pivot) {
+			n = n.right
+		} else {
+			found = it.depth
+			n = n.left
+		}
+	}
+	it.depth = found
+}
+
+// seekBefore positions the iterator on the greatest element of the tree that
+// is < `pivot`; the iterator is invalid if there is none.
+func (it *SimpleIterator) seekBefore(pivot Comparable) {
+	it.depth = 0
+	found := 0
+	for n := it.st.root; n != nil; {
+		it.push(n)
+		if n.data.Less(pivot) {
+			found = it.depth
+			n = n.right
+		} else {
+			n = n.left
+		}
+	}
+	it.depth = found
+}
+
+// Next moves the iterator to the next element; the iterator becomes invalid
+// if there is none.
+func (it *SimpleIterator) Next() {
+	if it.depth == 0 {
+		return
+	}
+
+	if right := it.top().right; right != nil {
+		it.descend(right, true)
+		return
+	}
+	// go up until we come from a left child
+	for {
+		child := it.pop()
+		if it.depth == 0 {
+			return
+		}
+		if it.top().right != child {
+			return
+		}
+	}
+}
+
+// Prev moves the iterator to the previous element; the iterator becomes
+// invalid if there is none.
+func (it *SimpleIterator) Prev() {
+	if it.depth == 0 {
+		return
+	}
+
+	if left := it.top().left; left != nil {
+		it.descend(left, false)
+		return
+	}
+	// go up until we come from a right child
+	for {
+		child := it.pop()
+		if it.depth == 0 {
+			return
+		}
+		if it.top().left != child {
+			return
+		}
+	}
+}
+
+// descend pushes `n`, then its leftmost (or rightmost) descendants.
+func (it *SimpleIterator) descend(n *simpleNode, leftmost bool) {
+	for n != nil {
+		it.push(n)
+		if leftmost {
+			n = n.left
+		} else {
+			n = n.right
+		}
+	}
+}
+
+func (it *SimpleIterator) push(n *simpleNode) {
+	if it.depth < iteratorDepth {
+		it.path[it.depth] = n
+	} else if i := it.depth - iteratorDepth; i < len(it.spill) {
+		it.spill[i] = n
+	} else {
+		it.spill = append(it.spill, n)
+	}
+	it.depth++
+}
+
+func (it *SimpleIterator) pop() *simpleNode {
+	n := it.top()
+	it.depth--
+	return n
+}
+
+func (it *SimpleIterator) top() *simpleNode {
+	if i := it.depth - 1; i < iteratorDepth {
+		return it.path[i]
+	}
+	return it.spill[it.depth-1-iteratorDepth]
+}
@@ -0,0 +1,121 @@
+// Copyright © 2015 Clement 'cmc' Rey <cr.rey.clement@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package freetree
+
+import "testing"
+
+// -----------------------------------------------------------------------------
+
+// cursor is implemented by both Iterator and SimpleIterator.
+type cursor interface {
+	Valid() bool
+	Value() Comparable
+	First()
+	Last()
+	Seek(pivot Comparable)
+	Next()
+	Prev()
+}
+
+// checkCursor checks `it` against a tree holding 0, 2, 4, ..., 2*(n-1).
+func checkCursor(t *testing.T, name string, it cursor, n int) {
+	i := 0
+	for it.First(); it.Valid(); it.Next() {
+		if it.Value() != intTest(2*i) {
+			t.Fatalf("%s: Next: unexpected retval at %d: %v", name, i, it.Value())
+		}
+		i++
+	}
+	if i != n || it.Value() != nil {
+		t.Fatalf("%s: expected %d elements, got %d", name, n, i)
+	}
+
+	for it.Last(); it.Valid(); it.Prev() {
+		i--
+		if it.Value() != intTest(2*i) {
+			t.Fatalf("%s: Prev: unexpected retval at %d: %v", name, i, it.Value())
+		}
+	}
+	if i != 0 {
+		t.Fatalf("%s: unexpected number of elements", name)
+	}
+
+	for pivot := -1; pivot < 2*n; pivot++ {
+		it.Seek(intTest(pivot))
+		expected := (pivot + 1) / 2 * 2
+		if expected >= 2*n {
+			if it.Valid() {
+				t.Errorf("%s: Seek(%d): expected invalid iterator", name, pivot)
+			}
+			continue
+		}
+		if it.Value() != intTest(expected) {
+			t.Errorf("%s: Seek(%d): unexpected retval %v", name, pivot, it.Value())
+		}
+		if it.Next(); expected+2 < 2*n && it.Value() != intTest(expected+2) {
+			t.Errorf("%s: Seek(%d) then Next: unexpected retval %v", name, pivot, it.Value())
+		}
+		it.Seek(intTest(pivot))
+		if it.Prev(); expected > 0 && it.Value() != intTest(expected-2) {
+			t.Errorf("%s: Seek(%d) then Prev: unexpected retval %v", name, pivot, it.Value())
+		}
+	}
+}
+
+func TestIterator(t *testing.T) {
+	for _, n := range []int{0, 1, 2, 3, 10, 100} {
+		st := NewSimpleTree()
+		for i := 0; i < n; i++ {
+			st.Insert(intTest(2 * i)) // degenerate on purpose
+		}
+		sit := st.Iterator()
+		checkCursor(t, "SimpleTree", &sit, n)
+
+		if n == 0 {
+			continue
+		}
+		ft, err := NewFreeTree(st)
+		if err != nil {
+			t.Fatal(err)
+		}
+		it := ft.Iterator()
+		checkCursor(t, "FreeTree", &it, n)
+		ft.Delete()
+
+		ft = buildLayout(t, EytzingerLayout, n, 2)
+		it = ft.Iterator()
+		checkCursor(t, "EytzingerLayout", &it, n)
+		ft.Delete()
+	}
+}
+
+func TestIterator_allocs(t *testing.T) {
+	ft := buildLayout(t, PointerLayout, 1000, 1)
+	defer ft.Delete()
+	st := NewSimpleTree().InsertArray(ft.FlattenOrder(InOrder))
+
+	it := ft.Iterator()
+	allocs := testing.AllocsPerRun(10, func() {
+		for it.First(); it.Valid(); it.Next() {
+		}
+		for it.Last(); it.Valid(); it.Prev() {
+		}
+	})
+	if allocs != 0 {
+		t.Errorf("Iterator: unexpected allocations: %v", allocs)
+	}
+
+	sit := st.Iterator()
+	allocs = testing.AllocsPerRun(10, func() {
+		for sit.First(); sit.Valid(); sit.Next() {
+		}
+		for sit.Last(); sit.Valid(); sit.Prev() {
+		}
+	})
+	if allocs != 0 {
+		t.Errorf("SimpleIterator: unexpected allocations: %v", allocs)
+	}
+}
@@ -0,0 +1,154 @@
+// Copyright © 2015 Clement 'cmc' Rey <cr.rey.clement@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package freetree
+
+import (
+	"fmt"
+	"math/bits"
+	"unsafe"
+
+	"github.com/teh-cmc/mmm"
+)
+
+// -----------------------------------------------------------------------------
+
+// Layout defines how a FreeTree lays out its elements in memory.
+type Layout int
+
+const (
+	// PointerLayout stores the elements in a data chunk, and the nodes, with
+	// explicit links to their children, in a separate node chunk.
+	// This is the default layout.
+	PointerLayout Layout = iota
+	// EytzingerLayout stores the elements in breadth-first order, with no
+	// node at all: the children of the i-th element are the (2i+1)-th and
+	// (2i+2)-th elements.
+	//
+	// The top levels of the tree, which every lookup goes through, are
+	// packed together at the start of the data chunk, where they stay in
+	// cache; and the elements of the next few levels are fetched ahead of
+	// time, while the current ones are being compared.
+	// This makes lookups much more cache-friendly than with a PointerLayout,
+	// at the cost of O(log²(n)) Select() and Rank().
+	EytzingerLayout
+)
+
+// String returns the name of the layout.
+func (l Layout) String() string {
+	switch l {
+	case PointerLayout:
+		return "PointerLayout"
+	case EytzingerLayout:
+		return "EytzingerLayout"
+	}
+	return fmt.Sprintf("Layout(%d)", int(l))
+}
+
+// -----------------------------------------------------------------------------
+
+// implicitNode returns `n` if it is a valid index in an EytzingerLayout'd
+// tree, or noNode otherwise.
+func (ft FreeTree) implicitNode(n uint64) uint32 {
+	if n >= uint64(ft.slots) {
+		return noNode
+	}
+	return uint32(n)
+}
+
+// implicitCount returns the number of nodes in the subtree rooted at index
+// `n` of a complete binary tree of `total` nodes stored in breadth-first
+// order.
+func implicitCount(n, total uint64) uint32 {
+	var count uint64
+	// the subtree has at most 2^depth nodes on each level, stored contiguously
+	for first, width := n, uint64(1); first < total; first, width = 2*first+1, 2*width {
+		if last := first + width; last < total {
+			count += width
+		} else {
+			count += total - first
+		}
+	}
+
+	return uint32(count)
+}
+
+// lowerBound returns the index of the smallest element that is >= `pivot` in
+// an EytzingerLayout'd tree, or noNode if there is none.
+//
+// The descent always goes all the way down to a leaf, rather than stopping
+// at the first element that is == `pivot`, so that the child to go to is
+// computed from the result of the comparison without branching on it.
+// Meanwhile, the first of the 16 descendants of the current node 4 levels
+// below is touched, so that it is already on its way to the cache by the
+// time the descent gets there.
+func (ft FreeTree) lowerBound(pivot Comparable) uint32 {
+	total := uint64(ft.slots)
+
+	// k is 1-based so that the children of k are 2k and 2k+1, i.e. 2i+1 and
+	// 2i+2 for i = k-1
+	k := uint64(1)
+	for k <= total {
+		ft.touch(16 * k)
+		k = 2*k + b2u(ft.view(uint32(k-1)).Less(pivot))
+	}
+	// every right turn (i.e. lower bits set to 1) leads to elements < pivot;
+	// the answer is the node where we took our last left turn
+	k >>= uint(bits.TrailingZeros64(^k) + 1)
+	if k == 0 {
+		return noNode
+	}
+
+	return uint32(k - 1)
+}
+
+// touch loads the first byte of the k-th (1-based) element of an
+// EytzingerLayout'd tree, if there is one.
+//
+// Go doesn't expose prefetch instructions: loading a byte whose value isn't
+// needed is the next best thing, since nothing waits for it to complete.
+func (ft FreeTree) touch(k uint64) {
+	if k <= uint64(ft.dataChunk.len) {
+		_ = *(*byte)(unsafe.Pointer(ft.dataChunk.base + uintptr(k-1)*ft.dataChunk.size))
+	}
+}
+
+// b2u returns 1 if `b` is true, 0 otherwise; it compiles down to a SETcc
+// rather than to a branch.
+func b2u(b bool) uint64 {
+	var u uint64
+	if b {
+		u = 1
+	}
+	return u
+}
+
+// eytzinger returns a new chunk containing the first `len` objects of
+// `sorted`, `size` bytes each, in Eytzinger order.
+//
+// `sorted` is left untouched.
+func eytzinger(sorted mmm.MemChunk, v interface{}, len int, size uintptr) (mmm.MemChunk, error) {
+	mc, err := mmm.NewMemChunk(v, uint(len))
+	if err != nil {
+		return mc, err
+	}
+
+	// an in-order traversal of the implicit tree visits its indices in the
+	// same order as the sorted elements
+	i := 0
+	var visit func(k int)
+	visit = func(k int) {
+		if k >= len {
+			return
+		}
+		visit(2*k + 1)
+		copy(chunkBytes(mc, k, k+1, size), chunkBytes(sorted, i, i+1, size))
+		i++
+		visit(2*k + 2)
+	}
+	visit(0)
+
+	return mc, nil
+}
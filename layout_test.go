@@ -0,0 +1,123 @@
+// Copyright © 2015 Clement 'cmc' Rey <cr.rey.clement@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package freetree
+
+import (
+	"math/rand"
+	"testing"
+)
+
+// -----------------------------------------------------------------------------
+
+func buildLayout(tb testing.TB, layout Layout, n int, step int) *FreeTree {
+	b := NewFreeTreeBuilder(n).SetLayout(layout)
+	for i := 0; i < n; i++ {
+		if err := b.Add(intTest(i * step)); err != nil {
+			tb.Fatal(err)
+		}
+	}
+	ft, err := b.Build()
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return ft
+}
+
+func TestFreeTree_eytzinger_layout(t *testing.T) {
+	for n := 1; n <= 33; n++ {
+		// even integers only, so that we can look for missing odd ones
+		ref := buildLayout(t, PointerLayout, n, 2)
+		ft := buildLayout(t, EytzingerLayout, n, 2)
+
+		if ft.Layout() != EytzingerLayout || ft.Len() != n {
+			t.Fatal("unexpected retval")
+		}
+		checkArray(t, "InOrder", ref.FlattenOrder(InOrder), ft.FlattenOrder(InOrder))
+
+		for i := -1; i <= 2*n; i++ {
+			pivot := intTest(i)
+			if ft.Ascend(pivot) != ref.Ascend(pivot) {
+				t.Errorf("n=%d: Ascend(%v): unexpected retval", n, pivot)
+			}
+			if ft.Floor(pivot) != ref.Floor(pivot) || ft.Ceiling(pivot) != ref.Ceiling(pivot) ||
+				ft.Predecessor(pivot) != ref.Predecessor(pivot) || ft.Successor(pivot) != ref.Successor(pivot) {
+				t.Errorf("n=%d: nearest(%v): unexpected retval", n, pivot)
+			}
+			if ft.Rank(pivot) != ref.Rank(pivot) {
+				t.Errorf("n=%d: Rank(%v): unexpected retval", n, pivot)
+			}
+			if ft.Select(i) != ref.Select(i) {
+				t.Errorf("n=%d: Select(%v): unexpected retval", n, i)
+			}
+		}
+
+		var ca, refCa ComparableArray
+		ft.AscendRange(intTest(3), intTest(2*n-3), collect(&ca, -1))
+		ref.AscendRange(intTest(3), intTest(2*n-3), collect(&refCa, -1))
+		checkArray(t, "AscendRange", refCa, ca)
+		ca, refCa = nil, nil
+		ft.DescendLessThan(intTest(n), collect(&ca, -1))
+		ref.DescendLessThan(intTest(n), collect(&refCa, -1))
+		checkArray(t, "DescendLessThan", refCa, ca)
+
+		ref.Delete()
+		ft.Delete()
+	}
+}
+
+func TestFreeTree_eytzinger_layout_persist(t *testing.T) {
+	ft := buildLayout(t, EytzingerLayout, 10, 1)
+	path := writeTree(t, ft)
+	expected := ft.FlattenOrder(LevelOrder)
+	ft.Delete()
+
+	opened, err := OpenFreeTree(path, intTest(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer opened.Delete()
+
+	if opened.Layout() != EytzingerLayout {
+		t.Error("unexpected layout")
+	}
+	checkArray(t, "LevelOrder", expected, opened.FlattenOrder(LevelOrder))
+	if opened.Ascend(intTest(7)) != intTest(7) {
+		t.Error("unexpected retval")
+	}
+}
+
+// -----------------------------------------------------------------------------
+
+// benchmarkAscend looks up random elements of `tree`, which holds the
+// integers in [0, n).
+func benchmarkAscend(b *testing.B, tree interface{ Ascend(Comparable) Comparable }, n int) {
+	pivots := make([]Comparable, 1<<16)
+	rng := rand.New(rand.NewSource(42))
+	for i := range pivots {
+		pivots[i] = intTest(rng.Intn(n))
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		tree.Ascend(pivots[i&(len(pivots)-1)])
+	}
+}
+
+func benchmarkLayout(b *testing.B, layout Layout) {
+	const n = 10 * 1e6
+	ft := buildLayout(b, layout, n, 1)
+	defer ft.Delete()
+
+	benchmarkAscend(b, ft, n)
+}
+
+func BenchmarkFreeTree_Ascend_10M_pointer_layout(b *testing.B) {
+	benchmarkLayout(b, PointerLayout)
+}
+
+func BenchmarkFreeTree_Ascend_10M_eytzinger_layout(b *testing.B) {
+	benchmarkLayout(b, EytzingerLayout)
+}
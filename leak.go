@@ -0,0 +1,86 @@
+// Copyright © 2015 Clement 'cmc' Rey <cr.rey.clement@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package freetree
+
+import (
+	"runtime"
+	"runtime/debug"
+	"sync"
+)
+
+// -----------------------------------------------------------------------------
+
+/////
+// Leak detection
+//
+// The garbage collector knows nothing about the off-heap memory of a
+// FreeTree: a tree that gets collected without having been deleted leaks its
+// chunks for the lifetime of the process.
+// When leak detection is enabled, every new FreeTree and FreeStringTree
+// records the stack trace of its creation, and a finalizer reports it if it
+// gets collected before Delete() is called.
+/////
+
+// LeakError reports a FreeTree (or FreeStringTree) that was garbage collected
+// without having been deleted.
+type LeakError struct {
+	// Stack is the stack trace of the goroutine that created the tree.
+	Stack string
+}
+
+// Error implements the error interface.
+func (e *LeakError) Error() string {
+	return "freetree: tree garbage collected without being deleted, created at:\n" + e.Stack
+}
+
+var leaks struct {
+	sync.Mutex
+	report func(err error)
+}
+
+// DetectLeaks enables leak detection for the FreeTrees and FreeStringTrees
+// created from now on: `report` is called with a *LeakError for every such
+// tree that gets garbage collected without Delete() having been called.
+// A nil `report` disables leak detection.
+//
+// `report` is called from the finalizers' goroutine, and must not block.
+// Recording stack traces is expensive: this is meant for debugging and
+// testing only.
+func DetectLeaks(report func(err error)) {
+	leaks.Lock()
+	leaks.report = report
+	leaks.Unlock()
+}
+
+// deletable is implemented by the structures whose leaks can be detected.
+type deletable interface {
+	// deleted returns true if Delete() has been called.
+	deleted() bool
+}
+
+// track sets up leak detection for `ft` if it is enabled, and returns `ft`.
+func track(ft *FreeTree) *FreeTree {
+	trackLeak(ft)
+	return ft
+}
+
+// trackLeak sets up leak detection for `d`, which must be a pointer to an
+// allocated object, if it is enabled.
+func trackLeak(d deletable) {
+	leaks.Lock()
+	report := leaks.report
+	leaks.Unlock()
+	if report == nil {
+		return
+	}
+
+	stack := string(debug.Stack())
+	runtime.SetFinalizer(d, func(d deletable) {
+		if !d.deleted() {
+			report(&LeakError{Stack: stack})
+		}
+	})
+}
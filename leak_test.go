@@ -0,0 +1,51 @@
+// Copyright © 2015 Clement 'cmc' Rey <cr.rey.clement@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package freetree
+
+import (
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+// -----------------------------------------------------------------------------
+
+func TestDetectLeaks(t *testing.T) {
+	leaked := make(chan error, 10)
+	DetectLeaks(func(err error) { leaked <- err })
+	defer DetectLeaks(nil)
+
+	deleted, err := NewFreeTreeFromSorted(ComparableArray{intTest(1), intTest(2)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	deleted.Delete()
+	if _, err := NewFreeTree(NewSimpleTree().Insert(intTest(1))); err != nil {
+		t.Fatal(err)
+	}
+
+	var leak error
+	for i := 0; i < 100 && leak == nil; i++ {
+		runtime.GC()
+		select {
+		case leak = <-leaked:
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	if e, ok := leak.(*LeakError); !ok || !strings.Contains(e.Stack, "TestDetectLeaks") {
+		t.Fatalf("expected a leak from TestDetectLeaks, got %v", leak)
+	}
+
+	// the deleted tree must not be reported
+	runtime.GC()
+	runtime.GC()
+	select {
+	case err := <-leaked:
+		t.Errorf("unexpected leak: %v", err)
+	case <-time.After(10 * time.Millisecond):
+	}
+}
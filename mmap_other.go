@@ -0,0 +1,27 @@
+// Copyright © 2015 Clement 'cmc' Rey <cr.rey.clement@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+//go:build !unix
+
+package freetree
+
+import (
+	"errors"
+	"os"
+)
+
+// -----------------------------------------------------------------------------
+
+var errMmapUnsupported = errors.New("freetree: memory-mapped files are not supported on this platform")
+
+// mmap is not supported on this platform.
+func mmap(f *os.File, size int) ([]byte, error) {
+	return nil, errMmapUnsupported
+}
+
+// munmap is not supported on this platform.
+func munmap(b []byte) error {
+	return errMmapUnsupported
+}
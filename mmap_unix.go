@@ -0,0 +1,25 @@
+// Copyright © 2015 Clement 'cmc' Rey <cr.rey.clement@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+//go:build unix
+
+package freetree
+
+import (
+	"os"
+	"syscall"
+)
+
+// -----------------------------------------------------------------------------
+
+// mmap maps the first `size` bytes of `f` in memory, read-only.
+func mmap(f *os.File, size int) ([]byte, error) {
+	return syscall.Mmap(int(f.Fd()), 0, size, syscall.PROT_READ, syscall.MAP_SHARED)
+}
+
+// munmap unmaps a mapping returned by mmap.
+func munmap(b []byte) error {
+	return syscall.Munmap(b)
+}
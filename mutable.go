@@ -0,0 +1,412 @@
+// Copyright © 2015 Clement 'cmc' Rey <cr.rey.clement@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package freetree
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"unsafe"
+
+	"github.com/teh-cmc/mmm"
+)
+
+// -----------------------------------------------------------------------------
+
+/////
+// Mutations
+//
+// A FreeTree using the PointerLayout can be modified in place: new elements
+// are written to a free slot of the node and data chunks, or appended to them
+// if there is none; the chunks are reallocated with twice their capacity when
+// they are full.
+//
+// Removed elements leave their slot to a free list, which is threaded through
+// the `left` field of the free nodes.
+//
+// Insertions and removals keep the tree balanced the same way an AVL tree
+// does, using the subtree heights stored in the nodes: as long as the tree
+// was balanced to begin with, it stays balanced whatever the order of the
+// updates.
+// Trees built with a FreeTreeBuilder are always balanced; trees built from a
+// SimpleTree have the same shape as the SimpleTree, which might not be.
+/////
+
+// ErrReadOnly is returned when trying to modify a FreeTree that cannot be
+// modified, i.e. a tree using the EytzingerLayout, a tree using a Codec or a
+// tree opened with OpenFreeTree().
+var ErrReadOnly = errors.New("freetree: tree is read-only")
+
+// Insert inserts `c` into the tree.
+//
+// `c` must be of the same type as the other elements of the tree.
+// Elements that are == `c` are kept: use Replace() to overwrite them.
+func (ft *FreeTree) Insert(c Comparable) error {
+	n, err := ft.alloc(c)
+	if err != nil {
+		return err
+	}
+	ft.insert(n, c)
+
+	return nil
+}
+
+// Remove removes the first element in the tree that is == `c`.
+//
+// It returns false if there is no such element.
+func (ft *FreeTree) Remove(c Comparable) (bool, error) {
+	if err := ft.checkWritable(); err != nil {
+		return false, err
+	}
+
+	removed := ft.remove(c)
+	if removed == noNode {
+		return false, nil
+	}
+	ft.release(removed)
+
+	return true, nil
+}
+
+// Rebalance rebalances the tree in place, in O(n), to guarantee O(log(n))
+// search complexity.
+//
+// Only the links between the nodes are rewritten: no element is moved
+// around, nor sorted.
+// There's no need to call it more than once, since Insert() and Remove()
+// keep the tree balanced.
+func (ft *FreeTree) Rebalance() error {
+	if err := ft.checkWritable(); err != nil {
+		return err
+	}
+	n := ft.Len()
+	if n == 0 {
+		return nil
+	}
+
+	// the in-order list of nodes lives off-heap as well
+	mc, err := mmm.NewMemChunk(uint32(0), uint(n))
+	if err != nil {
+		return err
+	}
+	defer mc.Delete()
+	order := unsafe.Slice((*uint32)(unsafe.Pointer(mc.Pointer(0))), n)
+
+	ft.root = ft.relink(ft.nodesInOrder(order[:0]))
+
+	return nil
+}
+
+// Replace replaces the first element in the tree that is == `c` with `c`, and
+// returns the replaced element.
+// If there is no such element, `c` is inserted and nil is returned.
+func (ft *FreeTree) Replace(c Comparable) (Comparable, error) {
+	if err := ft.checkWritable(); err != nil {
+		return nil, err
+	}
+	if err := ft.checkType(c); err != nil {
+		return nil, err
+	}
+
+	if n := ft.find(c); n != noNode {
+		old := ft.data(n)
+		ft.dataChunk.Write(int(n), c)
+		return old, nil
+	}
+
+	return nil, ft.Insert(c)
+}
+
+// -----------------------------------------------------------------------------
+
+// checkWritable returns ErrClosed if the tree has been deleted, and
+// ErrReadOnly if it cannot be modified.
+func (ft FreeTree) checkWritable() error {
+	if ft.closed {
+		return ErrClosed
+	}
+	if ft.layout != PointerLayout || ft.mapping != nil || ft.codec != nil {
+		return ErrReadOnly
+	}
+	return nil
+}
+
+// checkType returns an error if `c` cannot be stored alongside the other
+// elements of the tree.
+func (ft FreeTree) checkType(c Comparable) error {
+	if ft.dataChunk.typ != nil && reflect.TypeOf(c) != ft.dataChunk.typ {
+		return fmt.Errorf("freetree: cannot mix elements of type %v and %T", ft.dataChunk.typ, c)
+	}
+	return nil
+}
+
+// alloc writes `c` to a free slot, growing the chunks if needed, and returns
+// the index of the slot; its node has no children.
+func (ft *FreeTree) alloc(c Comparable) (uint32, error) {
+	if err := ft.checkWritable(); err != nil {
+		return noNode, err
+	}
+	if err := ft.checkType(c); err != nil {
+		return noNode, err
+	}
+
+	n := ft.free
+	if n != noNode {
+		ft.free = ft.node(n).left
+	} else {
+		if err := ft.reserve(c); err != nil {
+			return noNode, err
+		}
+		n = ft.slots
+		ft.slots++
+	}
+	*ft.node(n) = freeNode{left: noNode, right: noNode, size: 1, height: 1}
+	ft.dataChunk.Write(int(n), c)
+
+	return n, nil
+}
+
+// reserve makes sure that the chunks have room for one more slot, allocating
+// them for elements of the same type as `c` if the tree has none.
+func (ft *FreeTree) reserve(c Comparable) error {
+	if ft.slots >= math.MaxUint32-1 {
+		return ErrTooLarge
+	}
+	if ft.dataChunk.typ == nil {
+		nodeChunk, err := mmm.NewMemChunk(freeNode{}, 1)
+		if err != nil {
+			return err
+		}
+		dataChunk, err := mmm.NewMemChunk(c, 1)
+		if err != nil {
+			nodeChunk.Delete()
+			return err
+		}
+		ft.nodeChunk = newChunk(nodeChunk, freeNode{}, 1)
+		ft.dataChunk = newChunk(dataChunk, c, 1)
+		ft.root, ft.slots, ft.free = noNode, 0, noNode
+		return nil
+	}
+	if int(ft.slots) < ft.dataChunk.len {
+		return nil
+	}
+
+	capacity := 2 * ft.dataChunk.len
+	if err := ft.nodeChunk.Grow(capacity); err != nil {
+		return err
+	}
+	return ft.dataChunk.Grow(capacity)
+}
+
+// release adds the slot at index `n` to the free list.
+func (ft *FreeTree) release(n uint32) {
+	*ft.node(n) = freeNode{left: ft.free, right: noNode}
+	ft.free = n
+}
+
+// insert inserts the node at index `m`, whose element is `data`, into the
+// tree.
+//
+// Elements that are == `data` end up on its left.
+func (ft *FreeTree) insert(m uint32, data Comparable) {
+	if ft.root == noNode {
+		ft.root = m
+		return
+	}
+
+	path := make([]uint32, 0, iteratorDepth)
+	for n := ft.root; ; {
+		path = append(path, n)
+		node := ft.node(n)
+		if data.Less(ft.view(n)) {
+			if node.left == noNode {
+				node.left = m
+				break
+			}
+			n = node.left
+		} else {
+			if node.right == noNode {
+				node.right = m
+				break
+			}
+			n = node.right
+		}
+	}
+	ft.rebalancePath(path)
+}
+
+// remove unlinks the first node of the tree whose element is == `pivot`, and
+// returns its index, or noNode if there is none.
+func (ft *FreeTree) remove(pivot Comparable) uint32 {
+	path := make([]uint32, 0, iteratorDepth)
+	n := ft.root
+	for n != noNode {
+		data := ft.view(n)
+		if pivot.Less(data) {
+			path = append(path, n)
+			n = ft.node(n).left
+		} else if data.Less(pivot) {
+			path = append(path, n)
+			n = ft.node(n).right
+		} else {
+			break
+		}
+	}
+	if n == noNode {
+		return noNode
+	}
+
+	node := ft.node(n)
+	switch {
+	case node.left == noNode:
+		ft.replaceChild(path, n, node.right)
+	case node.right == noNode:
+		ft.replaceChild(path, n, node.left)
+	default:
+		// the successor takes the place of the removed node: no element has
+		// to be moved around
+		parents := len(path)
+		path = append(path, noNode) // the successor's slot, filled below
+		min := node.right
+		for ft.node(min).left != noNode {
+			path = append(path, min)
+			min = ft.node(min).left
+		}
+		m := ft.node(min)
+		if len(path) > parents+1 {
+			ft.node(path[len(path)-1]).left = m.right
+			m.right = node.right
+		}
+		m.left = node.left
+		ft.replaceChild(path[:parents], n, min)
+		path[parents] = min
+	}
+	ft.rebalancePath(path)
+
+	return n
+}
+
+// replaceChild makes `m` take the place of `n`, the child of the last node of
+// `path`, or the root of the tree if `path` is empty.
+func (ft *FreeTree) replaceChild(path []uint32, n, m uint32) {
+	if len(path) == 0 {
+		ft.root = m
+		return
+	}
+	if parent := ft.node(path[len(path)-1]); parent.left == n {
+		parent.left = m
+	} else {
+		parent.right = m
+	}
+}
+
+// rebalancePath balances the nodes of `path`, a path from the root of the
+// tree, from the bottom up.
+func (ft *FreeTree) rebalancePath(path []uint32) {
+	for i := len(path) - 1; i >= 0; i-- {
+		if n := ft.balance(path[i]); n != path[i] {
+			ft.replaceChild(path[:i], path[i], n)
+		}
+	}
+}
+
+// nodesInOrder appends the indices of the nodes of the tree to `order`, in
+// increasing order of their elements.
+func (ft FreeTree) nodesInOrder(order []uint32) []uint32 {
+	ft.walk(ft.root, InOrder, func(n uint32) {
+		order = append(order, n)
+	})
+	return order
+}
+
+// relink links the nodes of `order`, which are sorted, into a perfectly
+// balanced tree and returns the index of its root.
+func (ft FreeTree) relink(order []uint32) uint32 {
+	if len(order) == 0 {
+		return noNode
+	}
+
+	mid := len(order) / 2
+	node := ft.node(order[mid])
+	node.left = ft.relink(order[:mid])
+	node.right = ft.relink(order[mid+1:])
+	ft.update(order[mid])
+
+	return order[mid]
+}
+
+// -----------------------------------------------------------------------------
+
+// height returns the height of the subtree rooted at index `n`.
+func (ft FreeTree) height(n uint32) uint32 {
+	if n == noNode {
+		return 0
+	}
+	return ft.node(n).height
+}
+
+// update recomputes the size and height of the node at index `n` from those
+// of its children.
+func (ft FreeTree) update(n uint32) {
+	node := ft.node(n)
+	node.size = 1 + ft.count(node.left) + ft.count(node.right)
+	node.height = 1 + ft.height(node.left)
+	if h := 1 + ft.height(node.right); h > node.height {
+		node.height = h
+	}
+}
+
+// balance updates the node at index `n` and, if its subtrees' heights differ
+// by more than one, rotates it; it returns the new root of the subtree.
+func (ft FreeTree) balance(n uint32) uint32 {
+	ft.update(n)
+
+	node := ft.node(n)
+	left, right := ft.height(node.left), ft.height(node.right)
+	switch {
+	case left > right+1:
+		l := ft.node(node.left)
+		if ft.height(l.left) < ft.height(l.right) {
+			node.left = ft.rotateLeft(node.left)
+		}
+		return ft.rotateRight(n)
+	case right > left+1:
+		r := ft.node(node.right)
+		if ft.height(r.right) < ft.height(r.left) {
+			node.right = ft.rotateRight(node.right)
+		}
+		return ft.rotateLeft(n)
+	}
+
+	return n
+}
+
+// rotateLeft makes the right child of the node at index `n` the new root of
+// its subtree, and returns it.
+func (ft FreeTree) rotateLeft(n uint32) uint32 {
+	node := ft.node(n)
+	r := node.right
+	node.right = ft.node(r).left
+	ft.node(r).left = n
+	ft.update(n)
+	ft.update(r)
+
+	return r
+}
+
+// rotateRight makes the left child of the node at index `n` the new root of
+// its subtree, and returns it.
+func (ft FreeTree) rotateRight(n uint32) uint32 {
+	node := ft.node(n)
+	l := node.left
+	node.left = ft.node(l).right
+	ft.node(l).right = n
+	ft.update(n)
+	ft.update(l)
+
+	return l
+}
@@ -0,0 +1,212 @@
+// Copyright © 2015 Clement 'cmc' Rey <cr.rey.clement@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package freetree
+
+import (
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+// -----------------------------------------------------------------------------
+
+// checkMutated checks that `ft` contains exactly the elements of `expected`,
+// which must be sorted.
+func checkMutated(t *testing.T, ft *FreeTree, expected ComparableArray) {
+	t.Helper()
+	if ft.Len() != len(expected) {
+		t.Fatalf("expected %d elements, got %d", len(expected), ft.Len())
+	}
+	checkArray(t, "InOrder", expected, ft.FlattenOrder(InOrder))
+	for i, c := range expected {
+		if ft.Select(i) != c {
+			t.Errorf("Select(%d): unexpected retval", i)
+		}
+	}
+}
+
+func TestFreeTree_insert_remove(t *testing.T) {
+	ft, err := NewFreeTreeFromSorted(ComparableArray{intTest(10), intTest(20), intTest(30)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ft.Delete()
+
+	expected := ComparableArray{intTest(10), intTest(20), intTest(30)}
+	r := rand.New(rand.NewSource(42))
+	for i := 0; i < 2000; i++ {
+		c := intTest(r.Intn(100))
+		if r.Intn(3) > 0 {
+			if err := ft.Insert(c); err != nil {
+				t.Fatal(err)
+			}
+			expected = append(expected, c)
+			sort.Stable(expected)
+			continue
+		}
+
+		j := sort.Search(len(expected), func(j int) bool { return !expected[j].Less(c) })
+		found := j < len(expected) && expected[j] == c
+		if removed, err := ft.Remove(c); err != nil || removed != found {
+			t.Fatalf("Remove(%v): unexpected retval: %v, %v", c, removed, err)
+		}
+		if found {
+			expected = append(expected[:j], expected[j+1:]...)
+		}
+	}
+	checkBalanced(t, ft, ft.root)
+	checkMutated(t, ft, expected)
+
+	for _, c := range append(ComparableArray{}, expected...) {
+		if removed, err := ft.Remove(c); err != nil || !removed {
+			t.Fatalf("Remove(%v): unexpected retval: %v, %v", c, removed, err)
+		}
+	}
+	checkMutated(t, ft, ComparableArray{})
+
+	// removed slots are reused
+	slots := ft.slots
+	for i := 0; i < int(slots); i++ {
+		if err := ft.Insert(intTest(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if ft.slots != slots {
+		t.Errorf("expected %d slots, got %d", slots, ft.slots)
+	}
+}
+
+func TestFreeTree_replace(t *testing.T) {
+	ft, err := NewFreeTreeFromSorted(ComparableArray{intTest(1), intTest(2), intTest(3)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ft.Delete()
+
+	if old, err := ft.Replace(intTest(2)); err != nil || old != intTest(2) {
+		t.Errorf("unexpected retval: %v, %v", old, err)
+	}
+	if old, err := ft.Replace(intTest(4)); err != nil || old != nil {
+		t.Errorf("unexpected retval: %v, %v", old, err)
+	}
+	checkMutated(t, ft, ComparableArray{intTest(1), intTest(2), intTest(3), intTest(4)})
+
+	if err := ft.Insert(Int(5)); err == nil {
+		t.Error("expected error")
+	}
+	if _, err := ft.Replace(Int(5)); err == nil {
+		t.Error("expected error")
+	}
+}
+
+func TestFreeTree_read_only(t *testing.T) {
+	ft := buildLayout(t, EytzingerLayout, 10, 1)
+	defer ft.Delete()
+	if err := ft.Insert(intTest(42)); err != ErrReadOnly {
+		t.Errorf("expected ErrReadOnly, got %v", err)
+	}
+	if _, err := ft.Remove(intTest(1)); err != ErrReadOnly {
+		t.Errorf("expected ErrReadOnly, got %v", err)
+	}
+
+	pt := buildLayout(t, PointerLayout, 10, 1)
+	path := writeTree(t, pt)
+	pt.Delete()
+	opened, err := OpenFreeTree(path, intTest(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer opened.Delete()
+	if _, err := opened.Replace(intTest(1)); err != ErrReadOnly {
+		t.Errorf("expected ErrReadOnly, got %v", err)
+	}
+	if _, err := opened.Remove(intTest(1)); err != ErrReadOnly {
+		t.Errorf("expected ErrReadOnly, got %v", err)
+	}
+}
+
+// checkBalanced checks the sizes and heights stored in the subtree rooted at
+// index `n`, and that it is AVL-balanced; it returns the subtree's height.
+func checkBalanced(t *testing.T, ft *FreeTree, n uint32) uint32 {
+	if n == noNode {
+		return 0
+	}
+
+	node := ft.node(n)
+	left, right := checkBalanced(t, ft, node.left), checkBalanced(t, ft, node.right)
+	if left > right+1 || right > left+1 {
+		t.Fatalf("node %d: unbalanced subtrees: %d vs. %d", n, left, right)
+	}
+	if node.size != 1+ft.count(node.left)+ft.count(node.right) {
+		t.Fatalf("node %d: unexpected size %d", n, node.size)
+	}
+	height := 1 + left
+	if right > left {
+		height = 1 + right
+	}
+	if node.height != height {
+		t.Fatalf("node %d: expected height %d, got %d", n, height, node.height)
+	}
+
+	return height
+}
+
+func TestFreeTree_balanced_updates(t *testing.T) {
+	ft, err := NewFreeTreeFromSorted(ComparableArray{intTest(0)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ft.Delete()
+
+	// sorted insertions would make an unbalanced tree degenerate
+	expected := ComparableArray{intTest(0)}
+	for i := 1; i < 10000; i++ {
+		if err := ft.Insert(intTest(i)); err != nil {
+			t.Fatal(err)
+		}
+		expected = append(expected, intTest(i))
+	}
+	if h := checkBalanced(t, ft, ft.root); h > 20 {
+		t.Errorf("unexpected height: %d", h)
+	}
+	for i := 0; i < 10000; i += 2 {
+		if removed, err := ft.Remove(intTest(i)); err != nil || !removed {
+			t.Fatalf("Remove(%d): unexpected retval: %v, %v", i, removed, err)
+		}
+	}
+	checkBalanced(t, ft, ft.root)
+
+	kept := ComparableArray{}
+	for i := 1; i < len(expected); i += 2 {
+		kept = append(kept, expected[i])
+	}
+	checkMutated(t, ft, kept)
+}
+
+func TestFreeTree_rebalance(t *testing.T) {
+	st := NewSimpleTree()
+	expected := ComparableArray{}
+	for i := 0; i < 1000; i++ {
+		st.Insert(intTest(i))
+		expected = append(expected, intTest(i))
+	}
+	ft, err := NewFreeTree(st)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ft.Delete()
+	if ft.height(ft.root) != 1000 {
+		t.Fatalf("unexpected height: %d", ft.height(ft.root))
+	}
+
+	if err := ft.Rebalance(); err != nil {
+		t.Fatal(err)
+	}
+	if h := checkBalanced(t, ft, ft.root); h != 10 {
+		t.Errorf("unexpected height: %d", h)
+	}
+	checkMutated(t, ft, expected)
+}
@@ -0,0 +1,226 @@
+// Copyright © 2015 Clement 'cmc' Rey <cr.rey.clement@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package freetree
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"unsafe"
+)
+
+// -----------------------------------------------------------------------------
+
+/////
+// On-disk format
+//
+// A persisted FreeTree is made of 3 sections, each of them starting on a
+// 64-byte boundary:
+//   - a header, describing the tree and the type of its elements;
+//   - the nodes, i.e. a raw copy of the tree's node chunk (empty when using
+//     the EytzingerLayout);
+//   - the data, i.e. a raw copy of the tree's data chunk.
+//
+// Nodes only reference each other by index, hence both chunks can be used
+// in place once the file has been mapped in memory.
+//
+// The header is little-endian, but the node and data sections use the native
+// memory layout: a file can only be reopened by a program running on the
+// same architecture, using the same element type.
+/////
+
+const (
+	fileMagic   = "FREETREE"
+	fileVersion = 4
+	fileAlign   = 64
+)
+
+// ErrInvalidFile is returned when opening a file that doesn't contain a
+// valid FreeTree.
+var ErrInvalidFile = errors.New("freetree: invalid file")
+
+// ErrNotPersistable is returned when writing a FreeTree using a Codec: its
+// elements can only be decoded by the Codec itself.
+var ErrNotPersistable = errors.New("freetree: trees using a Codec cannot be persisted")
+
+// fileHeader is the header of a persisted FreeTree.
+//
+// It is directly followed by the name of the element type.
+type fileHeader struct {
+	Magic    [8]byte
+	Version  uint64
+	Layout   uint64
+	NbNodes  uint64
+	Root     uint64
+	ElemSize uint64
+	TypeLen  uint64
+}
+
+// fileLayout returns the offsets of the node and data sections.
+func fileLayout(typeLen, nbNodes int, layout Layout) (nodeOff, dataOff int) {
+	align := func(n int) int { return (n + fileAlign - 1) / fileAlign * fileAlign }
+	nodeOff = align(binary.Size(fileHeader{}) + typeLen)
+	dataOff = nodeOff
+	if layout == PointerLayout {
+		dataOff = align(nodeOff + nbNodes*int(unsafe.Sizeof(freeNode{})))
+	}
+	return nodeOff, dataOff
+}
+
+// WriteTo writes the tree to `w`, so that it can later be reopened using
+// OpenFreeTree().
+//
+// It implements io.WriterTo.
+func (ft FreeTree) WriteTo(w io.Writer) (int64, error) {
+	if ft.closed {
+		return 0, ErrClosed
+	}
+	if ft.codec != nil {
+		return 0, ErrNotPersistable
+	}
+	nbNodes := int(ft.slots)
+	typeName := ""
+	if nbNodes > 0 {
+		typeName = ft.dataChunk.typ.String()
+	}
+	nodeOff, dataOff := fileLayout(len(typeName), nbNodes, ft.layout)
+
+	h := fileHeader{
+		Version:  fileVersion,
+		Layout:   uint64(ft.layout),
+		NbNodes:  uint64(nbNodes),
+		Root:     uint64(ft.root),
+		ElemSize: uint64(ft.dataChunk.size),
+		TypeLen:  uint64(len(typeName)),
+	}
+	copy(h.Magic[:], fileMagic)
+
+	cw := &countWriter{w: w}
+	bw := bufio.NewWriter(cw)
+	binary.Write(bw, binary.LittleEndian, h)
+	bw.WriteString(typeName)
+	bw.Write(make([]byte, nodeOff-binary.Size(h)-len(typeName)))
+
+	var nodes []byte
+	if ft.layout == PointerLayout {
+		nodes = ft.nodeChunk.Bytes(nbNodes)
+	}
+	bw.Write(nodes)
+	bw.Write(make([]byte, dataOff-nodeOff-len(nodes)))
+	bw.Write(ft.dataChunk.Bytes(nbNodes))
+
+	err := bw.Flush()
+	return cw.n, err
+}
+
+// countWriter counts the number of bytes written to `w`.
+type countWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
+
+// OpenFreeTree reopens a FreeTree that was persisted to `path` using
+// WriteTo().
+//
+// `v` must be of the same type as the elements that were stored in the
+// tree: it is only used as a template, its value is ignored.
+//
+// The file is memory-mapped read-only and the tree is used directly from the
+// mapping, without any copy; i.e. the underlying physical memory is shared
+// between all the processes that open the same file.
+// The links between the nodes are checked once, when opening the file, so
+// that a corrupt file cannot make lookups read out of bounds.
+// As with any other FreeTree, Delete() must be called once the tree is not
+// needed anymore.
+func OpenFreeTree(path string, v Comparable) (*FreeTree, error) {
+	if err := ValidateComparable(v); err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if fi.Size() < int64(binary.Size(fileHeader{})) {
+		return nil, ErrInvalidFile
+	}
+	mapping, err := mmap(f, int(fi.Size()))
+	if err != nil {
+		return nil, err
+	}
+
+	ft, err := openMapping(mapping, v)
+	if err != nil {
+		munmap(mapping)
+		return nil, err
+	}
+
+	return ft, nil
+}
+
+// openMapping returns a FreeTree reading its data from `mapping`, which
+// contains a persisted FreeTree of `v`s.
+func openMapping(mapping []byte, v Comparable) (*FreeTree, error) {
+	var h fileHeader
+	hSize := binary.Size(h)
+	binary.Read(bytes.NewReader(mapping), binary.LittleEndian, &h)
+	if string(h.Magic[:]) != fileMagic || h.Version != fileVersion ||
+		h.TypeLen > uint64(len(mapping)-hSize) || h.NbNodes > uint64(len(mapping)) {
+		return nil, ErrInvalidFile
+	}
+
+	typ := reflect.TypeOf(v)
+	// an empty tree doesn't know the type of its elements
+	if name := string(mapping[hSize : hSize+int(h.TypeLen)]); name != typ.String() && !(name == "" && h.NbNodes == 0) {
+		return nil, fmt.Errorf("freetree: cannot open a tree of %s as a tree of %v", name, typ)
+	}
+	nbNodes := int(h.NbNodes)
+	layout := Layout(h.Layout)
+	if layout != PointerLayout && layout != EytzingerLayout {
+		return nil, ErrInvalidFile
+	}
+	nodeOff, dataOff := fileLayout(int(h.TypeLen), nbNodes, layout)
+	if (nbNodes > 0 && h.ElemSize != uint64(typ.Size())) || len(mapping) < dataOff+nbNodes*int(typ.Size()) ||
+		(h.Root >= h.NbNodes && h.Root != uint64(noNode)) || h.NbNodes >= uint64(noNode) {
+		return nil, ErrInvalidFile
+	}
+
+	ft := &FreeTree{
+		layout:    layout,
+		dataChunk: newBytesChunk(mapping, dataOff, v, nbNodes),
+		root:      uint32(h.Root),
+		slots:     uint32(nbNodes),
+		free:      noNode,
+		mapping:   mapping,
+	}
+	if layout == PointerLayout {
+		ft.nodeChunk = newBytesChunk(mapping, nodeOff, freeNode{}, nbNodes)
+		for n := uint32(0); n < ft.slots; n++ {
+			node := ft.node(n)
+			if (node.left >= ft.slots && node.left != noNode) || (node.right >= ft.slots && node.right != noNode) {
+				return nil, ErrInvalidFile
+			}
+		}
+	}
+
+	return track(ft), nil
+}
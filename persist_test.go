@@ -0,0 +1,138 @@
+// Copyright © 2015 Clement 'cmc' Rey <cr.rey.clement@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package freetree
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// -----------------------------------------------------------------------------
+
+func writeTree(t *testing.T, ft *FreeTree) string {
+	path := filepath.Join(t.TempDir(), "tree")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	n, err := ft.WriteTo(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi, _ := f.Stat(); fi.Size() != n {
+		t.Errorf("expected %d bytes, wrote %d", fi.Size(), n)
+	}
+
+	return path
+}
+
+func TestFreeTree_persist(t *testing.T) {
+	st := NewSimpleTree()
+	cs := ComparableArray{intTest(5), intTest(4), intTest(6), intTest(1), intTest(3), intTest(2)}
+
+	st.InsertArray(cs)
+
+	ft, err := NewFreeTree(st)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := writeTree(t, ft)
+
+	opened, err := OpenFreeTree(path, intTest(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer opened.Delete()
+
+	for _, order := range []TraversalOrder{PostOrder, InOrder, PreOrder, LevelOrder} {
+		checkArray(t, order.String(), ft.FlattenOrder(order), opened.FlattenOrder(order))
+	}
+	ft.Delete()
+
+	for i, c := range cs {
+		if opened.Ascend(c) != c {
+			t.Errorf("Ascend(%v): unexpected retval", c)
+		}
+		if opened.Select(i) != intTest(i+1) {
+			t.Errorf("Select(%d): unexpected retval", i)
+		}
+	}
+	if opened.Ascend(intTest(7)) != nil {
+		t.Error("unexpected retval")
+	}
+}
+
+func TestFreeTree_persist_empty(t *testing.T) {
+	empty, err := NewFreeTree(NewSimpleTree())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer empty.Delete()
+	emptied, err := NewFreeTreeFromSorted(ComparableArray{intTest(1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer emptied.Delete()
+	if _, err := emptied.Remove(intTest(1)); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, ft := range map[string]*FreeTree{"empty": empty, "emptied": emptied} {
+		opened, err := OpenFreeTree(writeTree(t, ft), intTest(0))
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if opened.Len() != 0 || opened.Ascend(intTest(1)) != nil || len(opened.Flatten()) != 0 {
+			t.Errorf("%s: unexpected retval", name)
+		}
+		opened.Delete()
+	}
+}
+
+func TestOpenFreeTree_errors(t *testing.T) {
+	ft, err := NewFreeTreeFromSorted(ComparableArray{intTest(1), intTest(2), intTest(3)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ft.Delete()
+	path := writeTree(t, ft)
+
+	if _, err := OpenFreeTree(path, Int(0)); err == nil {
+		t.Error("expected error")
+	}
+	if _, err := OpenFreeTree(filepath.Join(t.TempDir(), "nope"), intTest(0)); err == nil {
+		t.Error("expected error")
+	}
+
+	if _, err := OpenFreeTree(path, nil); err == nil {
+		t.Error("expected error")
+	}
+
+	b, _ := os.ReadFile(path)
+	// point the left child of the first node past the end of the tree
+	nodeOff, _ := fileLayout(len(reflect.TypeOf(intTest(0)).String()), 3, PointerLayout)
+	corrupt := append([]byte(nil), b...)
+	binary.LittleEndian.PutUint32(corrupt[nodeOff:], 3)
+	os.WriteFile(path, corrupt, 0644)
+	if _, err := OpenFreeTree(path, intTest(0)); err != ErrInvalidFile {
+		t.Errorf("expected ErrInvalidFile, got %v", err)
+	}
+
+	os.WriteFile(path, b[:len(b)-1], 0644)
+	if _, err := OpenFreeTree(path, intTest(0)); err != ErrInvalidFile {
+		t.Errorf("expected ErrInvalidFile, got %v", err)
+	}
+	b[0] = 'X'
+	os.WriteFile(path, b, 0644)
+	if _, err := OpenFreeTree(path, intTest(0)); err != ErrInvalidFile {
+		t.Errorf("expected ErrInvalidFile, got %v", err)
+	}
+}
@@ -0,0 +1,84 @@
+// Copyright © 2015 Clement 'cmc' Rey <cr.rey.clement@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.23
+
+package freetree
+
+import "iter"
+
+// -----------------------------------------------------------------------------
+
+// All returns an iterator over the elements of the tree, in increasing
+// order, to be used with `for range`.
+func (ft *FreeTree) All() iter.Seq[Comparable] {
+	return ft.Range(nil, nil)
+}
+
+// Backward returns an iterator over the elements of the tree, in decreasing
+// order, to be used with `for range`.
+func (ft *FreeTree) Backward() iter.Seq[Comparable] {
+	return func(yield func(Comparable) bool) {
+		it := ft.Iterator()
+		for it.Last(); it.Valid() && yield(it.Value()); it.Prev() {
+		}
+	}
+}
+
+// Range returns an iterator over the elements `e` of the tree such that
+// `greaterOrEqual` <= `e` < `lessThan`, in increasing order, to be used with
+// `for range`; a nil bound means unbounded.
+func (ft *FreeTree) Range(greaterOrEqual, lessThan Comparable) iter.Seq[Comparable] {
+	return func(yield func(Comparable) bool) {
+		it := ft.Iterator()
+		if greaterOrEqual == nil {
+			it.First()
+		} else {
+			it.Seek(greaterOrEqual)
+		}
+		for ; it.Valid(); it.Next() {
+			c := it.Value()
+			if (lessThan != nil && !c.Less(lessThan)) || !yield(c) {
+				return
+			}
+		}
+	}
+}
+
+// All returns an iterator over the elements of the tree, in increasing
+// order, to be used with `for range`.
+func (st *SimpleTree) All() iter.Seq[Comparable] {
+	return st.Range(nil, nil)
+}
+
+// Backward returns an iterator over the elements of the tree, in decreasing
+// order, to be used with `for range`.
+func (st *SimpleTree) Backward() iter.Seq[Comparable] {
+	return func(yield func(Comparable) bool) {
+		it := st.Iterator()
+		for it.Last(); it.Valid() && yield(it.Value()); it.Prev() {
+		}
+	}
+}
+
+// Range returns an iterator over the elements `e` of the tree such that
+// `greaterOrEqual` <= `e` < `lessThan`, in increasing order, to be used with
+// `for range`; a nil bound means unbounded.
+func (st *SimpleTree) Range(greaterOrEqual, lessThan Comparable) iter.Seq[Comparable] {
+	return func(yield func(Comparable) bool) {
+		it := st.Iterator()
+		if greaterOrEqual == nil {
+			it.First()
+		} else {
+			it.Seek(greaterOrEqual)
+		}
+		for ; it.Valid(); it.Next() {
+			c := it.Value()
+			if (lessThan != nil && !c.Less(lessThan)) || !yield(c) {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,46 @@
+// Copyright © 2015 Clement 'cmc' Rey <cr.rey.clement@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.23
+
+package freetree
+
+import "testing"
+
+// -----------------------------------------------------------------------------
+
+func TestFreeTree_seq(t *testing.T) {
+	ft := buildLayout(t, PointerLayout, 10, 1)
+	defer ft.Delete()
+	st := NewSimpleTree().InsertArray(ft.FlattenOrder(InOrder))
+
+	for _, name := range []string{"FreeTree", "SimpleTree"} {
+		all, backward, rng := ft.All(), ft.Backward(), ft.Range(intTest(3), intTest(6))
+		if name == "SimpleTree" {
+			all, backward, rng = st.All(), st.Backward(), st.Range(intTest(3), intTest(6))
+		}
+
+		var ca ComparableArray
+		for c := range all {
+			ca = append(ca, c)
+		}
+		checkArray(t, name+".All", ft.FlattenOrder(InOrder), ca)
+
+		ca = ca[:0]
+		for c := range backward {
+			ca = append(ca, c)
+			if len(ca) == 3 {
+				break
+			}
+		}
+		checkArray(t, name+".Backward", ComparableArray{intTest(9), intTest(8), intTest(7)}, ca)
+
+		ca = ca[:0]
+		for c := range rng {
+			ca = append(ca, c)
+		}
+		checkArray(t, name+".Range", ComparableArray{intTest(3), intTest(4), intTest(5)}, ca)
+	}
+}
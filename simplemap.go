@@ -0,0 +1,91 @@
+// Copyright © 2015 Clement 'cmc' Rey <cr.rey.clement@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package freetree
+
+// -----------------------------------------------------------------------------
+
+// SimpleMap implements a simple sorted map on top of a SimpleTree.
+type SimpleMap struct {
+	tree *SimpleTree
+}
+
+// NewSimpleMap returns an empty SimpleMap.
+func NewSimpleMap() *SimpleMap {
+	return &SimpleMap{tree: NewSimpleTree()}
+}
+
+// Insert associates `value` with `key` in the map, replacing any value
+// previously associated with `key`.
+// It does not rebalance the map, use Rebalance() for that.
+func (sm *SimpleMap) Insert(key Comparable, value interface{}) *SimpleMap {
+	e := mapEntry{key: key, value: value}
+	if n := sm.tree.root.find(e); n != nil {
+		n.data = e
+	} else {
+		sm.tree.Insert(e)
+	}
+
+	return sm
+}
+
+// Get returns the value associated with `key`.
+// The boolean is false if there is no such key in the map.
+func (sm SimpleMap) Get(key Comparable) (interface{}, bool) {
+	n := sm.tree.root.find(mapEntry{key: key})
+	if n == nil {
+		return nil, false
+	}
+	return n.data.(mapEntry).value, true
+}
+
+// Len returns the number of keys in the map.
+func (sm SimpleMap) Len() int {
+	return sm.tree.Len()
+}
+
+// Rebalance rebalances the map to guarantee O(log(n)) search complexity.
+//
+// See SimpleTree.Rebalance() for more information.
+func (sm *SimpleMap) Rebalance() *SimpleMap {
+	sm.tree.Rebalance()
+
+	return sm
+}
+
+// RebalanceGC rebalances the map and runs the garbage collector.
+func (sm *SimpleMap) RebalanceGC() *SimpleMap {
+	sm.tree.RebalanceGC()
+
+	return sm
+}
+
+// Delete sets all the pointers in the map to nil.
+//
+// See SimpleTree.Delete() for more information.
+func (sm *SimpleMap) Delete() *SimpleMap {
+	sm.tree.Delete()
+
+	return nil
+}
+
+// DeleteGC sets all the pointers of the map to nil and runs the garbage
+// collector.
+func (sm *SimpleMap) DeleteGC() *SimpleMap {
+	sm.tree.DeleteGC()
+
+	return nil
+}
+
+// -----------------------------------------------------------------------------
+
+// mapEntry is a key/value pair, ordered by key.
+type mapEntry struct {
+	key   Comparable
+	value interface{}
+}
+
+// Less returns true if `e.key` < `c.key`.
+func (e mapEntry) Less(c Comparable) bool { return e.key.Less(c.(mapEntry).key) }
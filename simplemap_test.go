@@ -0,0 +1,48 @@
+// Copyright © 2015 Clement 'cmc' Rey <cr.rey.clement@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package freetree
+
+import "testing"
+
+// -----------------------------------------------------------------------------
+
+type payloadTest struct {
+	a, b int
+}
+
+func TestSimpleMap_get(t *testing.T) {
+	sm := NewSimpleMap()
+	sm.Insert(intTest(5), payloadTest{5, 50}).
+		Insert(intTest(4), payloadTest{4, 40}).
+		Insert(intTest(6), payloadTest{6, 60}).
+		Insert(intTest(1), payloadTest{1, 10})
+	sm.Rebalance()
+
+	if sm.Len() != 4 {
+		t.Error("unexpected retval")
+	}
+	for _, k := range []intTest{1, 4, 5, 6} {
+		v, ok := sm.Get(k)
+		if !ok || v.(payloadTest) != (payloadTest{int(k), int(k) * 10}) {
+			t.Errorf("Get(%v): unexpected retval: %v", k, v)
+		}
+	}
+	if v, ok := sm.Get(intTest(2)); ok || v != nil {
+		t.Error("unexpected retval")
+	}
+}
+
+func TestSimpleMap_replace(t *testing.T) {
+	sm := NewSimpleMap()
+	sm.Insert(intTest(1), payloadTest{1, 10}).Insert(intTest(1), payloadTest{1, 11})
+
+	if sm.Len() != 1 {
+		t.Error("unexpected retval")
+	}
+	if v, ok := sm.Get(intTest(1)); !ok || v.(payloadTest).b != 11 {
+		t.Error("unexpected retval")
+	}
+}
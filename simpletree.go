@@ -6,17 +6,22 @@
 package freetree
 
 import (
+	"fmt"
 	"runtime"
 	"runtime/debug"
-	"sort"
 )
 
 // -----------------------------------------------------------------------------
 
 // SimpleTree implements a simple binary search tree.
 type SimpleTree struct {
-	root  *simpleNode
-	nodes uint
+	root       *simpleNode
+	nodes      uint
+	balancing  Balancing
+	duplicates Duplicates
+	// sparse is true when nodes have been removed since the ids were last
+	// assigned: ids are then made dense again by flattenNodes()
+	sparse bool
 }
 
 // NewSimpleTree returns an empty SimpleTree.
@@ -24,8 +29,45 @@ func NewSimpleTree() *SimpleTree {
 	return &SimpleTree{}
 }
 
+// NewBalancedSimpleTree returns an empty SimpleTree that keeps itself
+// balanced on every insertion, using the given strategy.
+func NewBalancedSimpleTree(balancing Balancing) *SimpleTree {
+	switch balancing {
+	case NoBalancing, AVLBalancing, RedBlackBalancing, TreapBalancing:
+	default:
+		panic(fmt.Sprintf("freetree: unknown balancing strategy: %v", balancing))
+	}
+	return &SimpleTree{balancing: balancing}
+}
+
+// SetDuplicates sets the policy used when inserting an element that is == to
+// an element already in the tree; the default is AllowDuplicates.
+//
+// It only applies to subsequent insertions.
+func (st *SimpleTree) SetDuplicates(duplicates Duplicates) *SimpleTree {
+	switch duplicates {
+	case AllowDuplicates, ReplaceDuplicates, RejectDuplicates:
+	default:
+		panic(fmt.Sprintf("freetree: unknown duplicates policy: %v", duplicates))
+	}
+	st.duplicates = duplicates
+
+	return st
+}
+
+// Duplicates returns the policy used when inserting an element that is == to
+// an element already in the tree.
+func (st SimpleTree) Duplicates() Duplicates {
+	return st.duplicates
+}
+
 // Insert inserts the given Comparables in the tree.
-// It does not rebalance the tree, use Rebalance() for that.
+// Unless the tree was created with NewBalancedSimpleTree(), it does not
+// rebalance the tree, use Rebalance() for that.
+//
+// Elements that are == to an element already in the tree are handled
+// according to the tree's Duplicates policy: use Add() to know whether an
+// element was rejected.
 //
 // If the tree is currently empty and the passed-in Comparable are already
 // sorted in increasing order, the tree will be perfectly balanced.
@@ -48,8 +90,9 @@ func (st *SimpleTree) insert(ca ComparableArray, id *uint) {
 		return
 	}
 
-	st.root = st.root.insert(ca[l/2], *id)
-	(*id)++
+	if st.insertOne(ca[l/2], *id) {
+		(*id)++
+	}
 
 	if l > 1 {
 		st.insert(ca[:l/2], id)
@@ -57,6 +100,60 @@ func (st *SimpleTree) insert(ca ComparableArray, id *uint) {
 	}
 }
 
+// Add inserts `c` in the tree, just like Insert() does.
+//
+// If the tree uses RejectDuplicates and already holds an element == `c`,
+// `c` is dropped and ErrDuplicate is returned.
+func (st *SimpleTree) Add(c Comparable) error {
+	if !st.insertOne(c, st.nodes) {
+		if st.duplicates == RejectDuplicates {
+			return ErrDuplicate
+		}
+		return nil
+	}
+	st.nodes++
+
+	return nil
+}
+
+// insertOne inserts `c` as the node identified by `id`, using the tree's
+// balancing strategy; it returns false if no node was added because of the
+// tree's Duplicates policy.
+func (st *SimpleTree) insertOne(c Comparable, id uint) bool {
+	if st.duplicates != AllowDuplicates {
+		if n := st.root.find(c); n != nil {
+			if st.duplicates == ReplaceDuplicates {
+				n.data = c
+			}
+			return false
+		}
+	}
+
+	switch st.balancing {
+	case AVLBalancing:
+		st.root = st.root.insertAVL(c, id)
+	case RedBlackBalancing:
+		st.root = st.root.insertRedBlack(c, id)
+		st.root.meta = 0 // the root is always black
+	case TreapBalancing:
+		st.root = st.root.insertTreap(c, id)
+	default:
+		st.root = st.root.insert(c, id)
+	}
+
+	return true
+}
+
+// Balancing returns the balancing strategy used by the tree.
+func (st SimpleTree) Balancing() Balancing {
+	return st.balancing
+}
+
+// Len returns the number of elements in the tree.
+func (st SimpleTree) Len() int {
+	return int(st.nodes)
+}
+
 // Ascend returns the first element in the tree that is == `pivot`.
 func (st SimpleTree) Ascend(pivot Comparable) Comparable {
 	return st.ascend(pivot)
@@ -66,20 +163,179 @@ func (st SimpleTree) ascend(pivot Comparable) Comparable {
 	return st.root.ascend(pivot)
 }
 
+// AscendEqual calls `visitor` on every element of the tree that is ==
+// `pivot`.
+// Iteration stops as soon as `visitor` returns false.
+func (st SimpleTree) AscendEqual(pivot Comparable, visitor Visitor) {
+	st.ascendEqual(pivot, visitor)
+}
+
+// Count returns the number of elements in the tree that are == `pivot`.
+func (st SimpleTree) Count(pivot Comparable) int {
+	n := 0
+	st.ascendEqual(pivot, func(Comparable) bool {
+		n++
+		return true
+	})
+
+	return n
+}
+
+// Floor returns the greatest element in the tree that is <= `pivot`, or nil if
+// there is none.
+func (st SimpleTree) Floor(pivot Comparable) Comparable {
+	return st.root.nearest(pivot, true, true)
+}
+
+// Ceiling returns the smallest element in the tree that is >= `pivot`, or nil
+// if there is none.
+func (st SimpleTree) Ceiling(pivot Comparable) Comparable {
+	return st.root.nearest(pivot, false, true)
+}
+
+// Predecessor returns the greatest element in the tree that is < `pivot`, or
+// nil if there is none.
+func (st SimpleTree) Predecessor(pivot Comparable) Comparable {
+	return st.root.nearest(pivot, true, false)
+}
+
+// Successor returns the smallest element in the tree that is > `pivot`, or nil
+// if there is none.
+func (st SimpleTree) Successor(pivot Comparable) Comparable {
+	return st.root.nearest(pivot, false, false)
+}
+
+// AscendRange calls `visitor` on every element `e` of the tree such that
+// `greaterOrEqual` <= `e` < `lessThan`, in increasing order.
+// Iteration stops as soon as `visitor` returns false.
+func (st SimpleTree) AscendRange(greaterOrEqual, lessThan Comparable, visitor Visitor) {
+	st.ascendRange(greaterOrEqual, lessThan, visitor)
+}
+
+// AscendGreaterOrEqual calls `visitor` on every element `e` of the tree such
+// that `e` >= `pivot`, in increasing order.
+// Iteration stops as soon as `visitor` returns false.
+func (st SimpleTree) AscendGreaterOrEqual(pivot Comparable, visitor Visitor) {
+	st.ascendRange(pivot, nil, visitor)
+}
+
+// DescendLessThan calls `visitor` on every element `e` of the tree such that
+// `e` < `pivot`, in decreasing order.
+// Iteration stops as soon as `visitor` returns false.
+func (st SimpleTree) DescendLessThan(pivot Comparable, visitor Visitor) {
+	st.descendRange(nil, pivot, visitor)
+}
+
+// ascendRange visits, in increasing order, every element `e` of the tree
+// such that `lo` <= `e` < `hi`; a nil bound means unbounded.
+func (st SimpleTree) ascendRange(lo, hi Comparable, visitor Visitor) {
+	it := st.Iterator()
+	if lo == nil {
+		it.First()
+	} else {
+		it.Seek(lo)
+	}
+	for ; it.Valid(); it.Next() {
+		data := it.top().data
+		if (hi != nil && !data.Less(hi)) || !visitor(data) {
+			return
+		}
+	}
+}
+
+// ascendEqual visits, in increasing order, every element of the tree that is
+// == `pivot`.
+func (st SimpleTree) ascendEqual(pivot Comparable, visitor Visitor) {
+	it := st.Iterator()
+	for it.Seek(pivot); it.Valid(); it.Next() {
+		data := it.top().data
+		if pivot.Less(data) || !visitor(data) {
+			return
+		}
+	}
+}
+
+// descendRange visits, in decreasing order, every element `e` of the tree
+// such that `lo` <= `e` < `hi`; a nil bound means unbounded.
+func (st SimpleTree) descendRange(lo, hi Comparable, visitor Visitor) {
+	it := st.Iterator()
+	if hi == nil {
+		it.Last()
+	} else {
+		it.seekBefore(hi)
+	}
+	for ; it.Valid(); it.Prev() {
+		data := it.top().data
+		if (lo != nil && data.Less(lo)) || !visitor(data) {
+			return
+		}
+	}
+}
+
+// Remove removes the first element in the tree that is == `c`.
+//
+// It returns false if there is no such element.
+func (st *SimpleTree) Remove(c Comparable) bool {
+	var removed bool
+	switch st.balancing {
+	case AVLBalancing:
+		st.root, removed = st.root.remove(c, (*simpleNode).balanceAVL)
+	case RedBlackBalancing:
+		if st.root.find(c) == nil {
+			return false
+		}
+		st.root, removed = st.root.removeRedBlack(c), true
+	case TreapBalancing:
+		st.root, removed = st.root.removeTreap(c)
+	default:
+		st.root, removed = st.root.remove(c, nil)
+	}
+	if removed {
+		st.nodes--
+		st.sparse = true
+	}
+
+	return removed
+}
+
+// RemoveRange removes every element `e` of the tree such that
+// `greaterOrEqual` <= `e` < `lessThan`, and returns the number of removed
+// elements.
+func (st *SimpleTree) RemoveRange(greaterOrEqual, lessThan Comparable) int {
+	var ca ComparableArray
+	st.ascendRange(greaterOrEqual, lessThan, func(c Comparable) bool {
+		ca = append(ca, c)
+		return true
+	})
+	for _, c := range ca {
+		st.Remove(c)
+	}
+
+	return len(ca)
+}
+
 // Rebalance rebalances the tree to guarantee O(log(n)) search complexity.
 //
+// Trees created with NewBalancedSimpleTree() are always balanced: this is a
+// no-op for them.
+//
 // Rebalancing is implemented as straightforwardly as possible: it's dumb.
 // I strongly suggest running the garbage collector and scavenger once it's done.
 //   runtime.GC()
 //   debug.FreeOSMemory()
 // Alternatively, you can use RebalanceGC().
 func (st *SimpleTree) Rebalance() *SimpleTree {
-	flat := st.flatten()
-	sort.Sort(flat)
+	if st.balancing != NoBalancing {
+		return st
+	}
 
-	st.root = nil
+	flat := st.flatten(InOrder)
+
+	// elements are relinked as they are: the duplicates policy only applies
+	// to new insertions
 	st.nodes = 0
-	st.insert(flat, &st.nodes)
+	st.root = buildSimpleNodes(flat, &st.nodes)
+	st.sparse = false
 
 	return st
 }
@@ -99,6 +355,8 @@ func (st *SimpleTree) RebalanceGC() *SimpleTree {
 //   runtime.GC()
 //   debug.FreeOSMemory()
 // Alternatively, you can use DeleteGC().
+//
+// Use Remove() to remove a single element from the tree.
 func (st *SimpleTree) Delete() *SimpleTree {
 	st.root.delete()
 	runtime.GC()
@@ -117,19 +375,44 @@ func (st *SimpleTree) DeleteGC() *SimpleTree {
 	return nil
 }
 
-// Flatten returns the content of the tree as a ComparableArray.
+// Flatten returns the content of the tree as a ComparableArray, in PostOrder.
 func (st SimpleTree) Flatten() ComparableArray {
-	return st.flatten()
+	return st.flatten(PostOrder)
 }
 
-func (st SimpleTree) flatten() ComparableArray {
+// FlattenOrder returns the content of the tree as a ComparableArray, using
+// the given traversal order.
+//
+// Use InOrder to get the elements sorted in increasing order.
+func (st SimpleTree) FlattenOrder(order TraversalOrder) ComparableArray {
+	return st.flatten(order)
+}
+
+func (st SimpleTree) flatten(order TraversalOrder) ComparableArray {
 	ca := make(ComparableArray, 0, st.nodes)
-	return st.root.flatten(ca)
+	switch order {
+	case PostOrder, InOrder, PreOrder:
+		return st.root.flatten(ca, order)
+	case LevelOrder:
+		return st.root.flattenLevels(ca)
+	}
+	panic(fmt.Sprintf("freetree: unknown traversal order: %v", order))
 }
 
-func (st SimpleTree) flattenNodes() []*simpleNode {
+// flattenNodes returns the nodes of the tree in PostOrder.
+//
+// Their ids are guaranteed to be dense, i.e. to cover [0, st.nodes).
+func (st *SimpleTree) flattenNodes() []*simpleNode {
 	na := make([]*simpleNode, 0, st.nodes)
-	return st.root.flattenNodes(na)
+	na = st.root.flattenNodes(na)
+	if st.sparse {
+		for i, n := range na {
+			n.id = uint(i)
+		}
+		st.sparse = false
+	}
+
+	return na
 }
 
 // -----------------------------------------------------------------------------
@@ -138,63 +421,277 @@ type simpleNode struct {
 	id          uint
 	left, right *simpleNode
 	data        Comparable
+	meta        uint32 // balancing metadata, see balancing.go
 }
 
 func (sn *simpleNode) insert(c Comparable, id uint) *simpleNode {
+	node := &simpleNode{id: id, data: c}
 	if sn == nil {
-		return &simpleNode{id: id, data: c}
+		return node
+	}
+
+	for n := sn; ; {
+		if c.Less(n.data) {
+			if n.left == nil {
+				n.left = node
+				break
+			}
+			n = n.left
+		} else {
+			if n.right == nil {
+				n.right = node
+				break
+			}
+			n = n.right
+		}
+	}
+
+	return sn
+}
+
+// buildSimpleNodes returns a perfectly balanced subtree holding `ca`, which is
+// sorted, and numbers its nodes from `*id` on.
+func buildSimpleNodes(ca ComparableArray, id *uint) *simpleNode {
+	if len(ca) == 0 {
+		return nil
+	}
+
+	mid := len(ca) / 2
+	sn := &simpleNode{id: *id, data: ca[mid]}
+	(*id)++
+	sn.left = buildSimpleNodes(ca[:mid], id)
+	sn.right = buildSimpleNodes(ca[mid+1:], id)
+
+	return sn
+}
+
+// remove unlinks the first node of the subtree whose data is == `c`, and
+// returns the new root of the subtree along with whether a node was removed.
+//
+// If `fix` isn't nil, it is called on every node whose subtree changed, from
+// the bottom up, and returns the new root of the node's subtree.
+func (sn *simpleNode) remove(c Comparable, fix func(*simpleNode) *simpleNode) (*simpleNode, bool) {
+	path := make([]*simpleNode, 0, iteratorDepth)
+	n := sn
+	for n != nil {
+		if c.Less(n.data) {
+			path = append(path, n)
+			n = n.left
+		} else if n.data.Less(c) {
+			path = append(path, n)
+			n = n.right
+		} else {
+			break
+		}
+	}
+	if n == nil {
+		return sn, false
 	}
 
-	if c.Less(sn.data) {
-		sn.left = sn.left.insert(c, id)
+	parents := len(path)
+	var m *simpleNode
+	switch {
+	case n.left == nil:
+		m = n.right
+	case n.right == nil:
+		m = n.left
+	default:
+		// the successor takes the place of the removed node
+		path = append(path, nil) // the successor's slot, filled below
+		m = n.right
+		for m.left != nil {
+			path = append(path, m)
+			m = m.left
+		}
+		if len(path) > parents+1 {
+			path[len(path)-1].left = m.right
+			m.right = n.right
+		}
+		m.left = n.left
+		path[parents] = m
+	}
+	sn = sn.replaceChild(path[:parents], n, m)
+
+	if fix != nil {
+		for i := len(path) - 1; i >= 0; i-- {
+			if f := fix(path[i]); f != path[i] {
+				sn = sn.replaceChild(path[:i], path[i], f)
+			}
+		}
+	}
+
+	return sn, true
+}
+
+// replaceChild makes `m` take the place of `n`, the child of the last node of
+// `path`, or the root of the subtree if `path` is empty; it returns the new
+// root of the subtree.
+func (sn *simpleNode) replaceChild(path []*simpleNode, n, m *simpleNode) *simpleNode {
+	if len(path) == 0 {
+		return m
+	}
+	if parent := path[len(path)-1]; parent.left == n {
+		parent.left = m
 	} else {
-		sn.right = sn.right.insert(c, id)
+		parent.right = m
 	}
 
 	return sn
 }
 
 func (sn *simpleNode) ascend(pivot Comparable) Comparable {
-	if sn == nil {
-		return nil
+	if n := sn.find(pivot); n != nil {
+		return n.data
+	}
+
+	return nil
+}
+
+// find returns the first node of the subtree whose data is == `pivot`, or nil
+// if there is none.
+func (sn *simpleNode) find(pivot Comparable) *simpleNode {
+	for n := sn; n != nil; {
+		if pivot.Less(n.data) {
+			n = n.left
+		} else if n.data.Less(pivot) {
+			n = n.right
+		} else {
+			return n
+		}
 	}
 
-	if pivot.Less(sn.data) {
-		return sn.left.ascend(pivot)
-	} else if sn.data.Less(pivot) {
-		return sn.right.ascend(pivot)
+	return nil
+}
+
+// nearest returns the greatest element of the subtree that is < `pivot` if
+// `below` is true, or the smallest element that is > `pivot` otherwise.
+// If `orEqual` is true, an element == `pivot` is returned as soon as it is
+// found.
+func (sn *simpleNode) nearest(pivot Comparable, below, orEqual bool) Comparable {
+	var best Comparable
+	for n := sn; n != nil; {
+		if n.data.Less(pivot) {
+			if below {
+				best = n.data
+			}
+			n = n.right
+		} else if pivot.Less(n.data) {
+			if !below {
+				best = n.data
+			}
+			n = n.left
+		} else if orEqual {
+			return n.data
+		} else if below {
+			n = n.left
+		} else {
+			n = n.right
+		}
 	}
 
-	return sn.data
+	return best
 }
 
 func (sn *simpleNode) delete() *simpleNode {
-	if sn != nil {
-		sn.left = sn.left.delete()
-		sn.right = sn.right.delete()
-	}
+	sn.walk(PostOrder, func(n *simpleNode) {
+		n.left, n.right = nil, nil
+	})
 
 	return nil
 }
 
-func (sn *simpleNode) flatten(ca ComparableArray) ComparableArray {
+func (sn *simpleNode) flatten(ca ComparableArray, order TraversalOrder) ComparableArray {
+	sn.walk(order, func(n *simpleNode) {
+		ca = append(ca, n.data)
+	})
+
+	return ca
+}
+
+func (sn *simpleNode) flattenLevels(ca ComparableArray) ComparableArray {
 	if sn == nil {
 		return ca
 	}
 
-	ca = sn.left.flatten(ca)
-	ca = sn.right.flatten(ca)
+	queue := []*simpleNode{sn}
+	for len(queue) > 0 {
+		n := queue[0]
+		queue = queue[1:]
+		ca = append(ca, n.data)
+		if n.left != nil {
+			queue = append(queue, n.left)
+		}
+		if n.right != nil {
+			queue = append(queue, n.right)
+		}
+	}
 
-	return append(ca, sn.data)
+	return ca
 }
 
 func (sn *simpleNode) flattenNodes(na []*simpleNode) []*simpleNode {
+	sn.walk(PostOrder, func(n *simpleNode) {
+		na = append(na, n)
+	})
+
+	return na
+}
+
+// walk calls `visit` on every node of the subtree, using the given
+// depth-first traversal order.
+//
+// The traversal uses an explicit stack: its memory usage is proportional to
+// the height of the tree, but it never grows the goroutine's stack.
+// In PostOrder, `visit` may unlink the children of the node it is given.
+func (sn *simpleNode) walk(order TraversalOrder, visit func(n *simpleNode)) {
 	if sn == nil {
-		return na
+		return
 	}
 
-	na = sn.left.flattenNodes(na)
-	na = sn.right.flattenNodes(na)
-
-	return append(na, sn)
+	stack := make([]*simpleNode, 0, iteratorDepth)
+	n := sn
+	switch order {
+	case PreOrder:
+		stack = append(stack, n)
+		for len(stack) > 0 {
+			n = stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			left, right := n.left, n.right
+			visit(n)
+			if right != nil {
+				stack = append(stack, right)
+			}
+			if left != nil {
+				stack = append(stack, left)
+			}
+		}
+	case InOrder:
+		for n != nil || len(stack) > 0 {
+			for ; n != nil; n = n.left {
+				stack = append(stack, n)
+			}
+			n = stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			right := n.right
+			visit(n)
+			n = right
+		}
+	case PostOrder:
+		var last *simpleNode
+		for n != nil || len(stack) > 0 {
+			if n != nil {
+				stack = append(stack, n)
+				n = n.left
+				continue
+			}
+			top := stack[len(stack)-1]
+			if top.right != nil && top.right != last {
+				n = top.right
+			} else {
+				visit(top)
+				last = top
+				stack = stack[:len(stack)-1]
+			}
+		}
+	}
 }
@@ -7,6 +7,8 @@ package freetree
 
 import (
 	"log"
+	"math/rand"
+	"runtime/debug"
 	"testing"
 )
 
@@ -166,3 +168,297 @@ func TestSimpleTree_pair_unsorted_input_rebalanced(t *testing.T) {
 		t.Error("unexpected retval")
 	}
 }
+
+func TestSimpleTree_traversal_orders(t *testing.T) {
+	expected := map[TraversalOrder]ComparableArray{
+		PostOrder:  {intTest(1), intTest(3), intTest(2), intTest(5), intTest(6), intTest(4)},
+		InOrder:    {intTest(1), intTest(2), intTest(3), intTest(4), intTest(5), intTest(6)},
+		PreOrder:   {intTest(4), intTest(2), intTest(1), intTest(3), intTest(6), intTest(5)},
+		LevelOrder: {intTest(4), intTest(2), intTest(6), intTest(1), intTest(3), intTest(5)},
+	}
+
+	st := NewSimpleTree()
+	cs := ComparableArray{intTest(5), intTest(4), intTest(6), intTest(1), intTest(3), intTest(2)}
+
+	st.InsertArray(cs)
+	st.Rebalance()
+
+	for order, exp := range expected {
+		flat := st.FlattenOrder(order)
+		if len(flat) != len(exp) {
+			t.Errorf("%v: expected != flat", order)
+			continue
+		}
+		for i := range exp {
+			if flat[i] != exp[i] {
+				t.Errorf("%v: expected != flat", order)
+				break
+			}
+		}
+	}
+
+	if len(NewSimpleTree().FlattenOrder(LevelOrder)) != 0 {
+		t.Error("unexpected retval")
+	}
+}
+
+// -----------------------------------------------------------------------------
+
+// collect returns a Visitor that appends visited elements to `ca` and stops
+// once `max` elements have been collected; max < 0 means no limit.
+func collect(ca *ComparableArray, max int) Visitor {
+	return func(c Comparable) bool {
+		*ca = append(*ca, c)
+		return max < 0 || len(*ca) < max
+	}
+}
+
+func checkArray(t *testing.T, name string, expected, flat ComparableArray) {
+	if len(flat) != len(expected) {
+		t.Errorf("%s: expected %v, got %v", name, expected, flat)
+		return
+	}
+	for i := range expected {
+		if flat[i] != expected[i] {
+			t.Errorf("%s: expected %v, got %v", name, expected, flat)
+			return
+		}
+	}
+}
+
+func TestSimpleTree_range_queries(t *testing.T) {
+	st := NewSimpleTree()
+	cs := ComparableArray{intTest(5), intTest(4), intTest(6), intTest(1), intTest(3), intTest(2)}
+
+	st.InsertArray(cs)
+
+	var ca ComparableArray
+	st.AscendRange(intTest(2), intTest(5), collect(&ca, -1))
+	checkArray(t, "AscendRange", ComparableArray{intTest(2), intTest(3), intTest(4)}, ca)
+
+	ca = nil
+	st.AscendRange(intTest(0), intTest(100), collect(&ca, 2))
+	checkArray(t, "AscendRange (early stop)", ComparableArray{intTest(1), intTest(2)}, ca)
+
+	ca = nil
+	st.AscendRange(intTest(4), intTest(4), collect(&ca, -1))
+	checkArray(t, "AscendRange (empty)", ComparableArray{}, ca)
+
+	ca = nil
+	st.AscendGreaterOrEqual(intTest(4), collect(&ca, -1))
+	checkArray(t, "AscendGreaterOrEqual", ComparableArray{intTest(4), intTest(5), intTest(6)}, ca)
+
+	ca = nil
+	st.AscendGreaterOrEqual(intTest(3), collect(&ca, 2))
+	checkArray(t, "AscendGreaterOrEqual (early stop)", ComparableArray{intTest(3), intTest(4)}, ca)
+
+	ca = nil
+	st.DescendLessThan(intTest(4), collect(&ca, -1))
+	checkArray(t, "DescendLessThan", ComparableArray{intTest(3), intTest(2), intTest(1)}, ca)
+
+	ca = nil
+	st.DescendLessThan(intTest(7), collect(&ca, 4))
+	checkArray(t, "DescendLessThan (early stop)", ComparableArray{intTest(6), intTest(5), intTest(4), intTest(3)}, ca)
+}
+
+// nearestTest describes the expected results of Floor, Ceiling, Predecessor
+// and Successor for a given pivot, over a tree containing 2, 4, 6, 8 and 10.
+type nearestTest struct {
+	pivot                                  intTest
+	floor, ceiling, predecessor, successor Comparable
+}
+
+var nearestTests = []nearestTest{
+	{1, nil, intTest(2), nil, intTest(2)},
+	{2, intTest(2), intTest(2), nil, intTest(4)},
+	{5, intTest(4), intTest(6), intTest(4), intTest(6)},
+	{6, intTest(6), intTest(6), intTest(4), intTest(8)},
+	{10, intTest(10), intTest(10), intTest(8), nil},
+	{11, intTest(10), nil, intTest(10), nil},
+}
+
+func TestSimpleTree_nearest(t *testing.T) {
+	st := NewSimpleTree()
+	cs := ComparableArray{intTest(8), intTest(2), intTest(10), intTest(6), intTest(4)}
+
+	st.InsertArray(cs)
+
+	for _, nt := range nearestTests {
+		if c := st.Floor(nt.pivot); c != nt.floor {
+			t.Errorf("Floor(%v): expected %v, got %v", nt.pivot, nt.floor, c)
+		}
+		if c := st.Ceiling(nt.pivot); c != nt.ceiling {
+			t.Errorf("Ceiling(%v): expected %v, got %v", nt.pivot, nt.ceiling, c)
+		}
+		if c := st.Predecessor(nt.pivot); c != nt.predecessor {
+			t.Errorf("Predecessor(%v): expected %v, got %v", nt.pivot, nt.predecessor, c)
+		}
+		if c := st.Successor(nt.pivot); c != nt.successor {
+			t.Errorf("Successor(%v): expected %v, got %v", nt.pivot, nt.successor, c)
+		}
+	}
+}
+
+func TestSimpleTree_remove(t *testing.T) {
+	for _, balancing := range []Balancing{NoBalancing, AVLBalancing, RedBlackBalancing, TreapBalancing} {
+		st := NewBalancedSimpleTree(balancing)
+		counts := make(map[intTest]int)
+		r := rand.New(rand.NewSource(42))
+		for i := 0; i < 5000; i++ {
+			c := intTest(r.Intn(500))
+			if r.Intn(3) > 0 {
+				st.Insert(c)
+				counts[c]++
+				continue
+			}
+			if st.Remove(c) != (counts[c] > 0) {
+				t.Fatalf("%v: Remove(%v): unexpected retval", balancing, c)
+			}
+			if counts[c] > 0 {
+				counts[c]--
+			}
+		}
+		checkInvariants(t, st.root, balancing)
+
+		expected := ComparableArray{}
+		for i := intTest(0); i < 500; i++ {
+			for j := 0; j < counts[i]; j++ {
+				expected = append(expected, i)
+			}
+		}
+		if st.Len() != len(expected) {
+			t.Fatalf("%v: unexpected length", balancing)
+		}
+		checkArray(t, balancing.String(), expected, st.FlattenOrder(InOrder))
+
+		// ids must be dense for NewFreeTree to work
+		ft, err := NewFreeTree(st)
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkArray(t, balancing.String(), expected, ft.FlattenOrder(InOrder))
+		ft.Delete()
+		ids := make([]bool, st.Len())
+		for _, n := range st.flattenNodes() {
+			if n.id >= uint(len(ids)) || ids[n.id] {
+				t.Fatalf("%v: invalid id %d", balancing, n.id)
+			}
+			ids[n.id] = true
+		}
+	}
+}
+
+func TestSimpleTree_remove_range(t *testing.T) {
+	for _, balancing := range []Balancing{NoBalancing, AVLBalancing, RedBlackBalancing, TreapBalancing} {
+		st := NewBalancedSimpleTree(balancing)
+		for i := 0; i < 100; i++ {
+			st.Insert(intTest(i))
+		}
+
+		if n := st.RemoveRange(intTest(10), intTest(90)); n != 80 {
+			t.Errorf("%v: unexpected retval: %d", balancing, n)
+		}
+		if n := st.RemoveRange(nil, intTest(5)); n != 5 {
+			t.Errorf("%v: unexpected retval: %d", balancing, n)
+		}
+		if n := st.RemoveRange(intTest(50), intTest(60)); n != 0 {
+			t.Errorf("%v: unexpected retval: %d", balancing, n)
+		}
+		checkInvariants(t, st.root, balancing)
+
+		expected := ComparableArray{intTest(5), intTest(6), intTest(7), intTest(8), intTest(9)}
+		for i := 90; i < 100; i++ {
+			expected = append(expected, intTest(i))
+		}
+		checkArray(t, balancing.String(), expected, st.FlattenOrder(InOrder))
+		if st.Len() != len(expected) {
+			t.Errorf("%v: unexpected length", balancing)
+		}
+	}
+}
+
+// degenerateTree returns an unbalanced SimpleTree holding 0, 1, ..., n-1, in
+// which every node is the right child of the previous one.
+//
+// It is built by hand: inserting sorted elements one at a time would take
+// O(n^2).
+func degenerateTree(n int) *SimpleTree {
+	st := NewSimpleTree()
+	var last *simpleNode
+	for i := n - 1; i >= 0; i-- {
+		last = &simpleNode{id: uint(i), data: intTest(i), right: last}
+	}
+	st.root, st.nodes = last, uint(n)
+
+	return st
+}
+
+// checkSequence checks that `ca` holds `n` consecutive elements starting at
+// `first`, in increasing (or decreasing) order.
+func checkSequence(t *testing.T, name string, ca ComparableArray, first, n int, decreasing bool) {
+	if len(ca) != n {
+		t.Errorf("%s: expected %d elements, got %d", name, n, len(ca))
+		return
+	}
+	for i, c := range ca {
+		expected := first + i
+		if decreasing {
+			expected = first - i
+		}
+		if c != intTest(expected) {
+			t.Errorf("%s: unexpected element at %d: %v", name, i, c)
+			return
+		}
+	}
+}
+
+func TestSimpleTree_degenerate(t *testing.T) {
+	// recursing over a million nodes would need way more than that
+	defer debug.SetMaxStack(debug.SetMaxStack(1 << 20))
+
+	const n = 1000000
+	st := degenerateTree(n)
+
+	checkSequence(t, "InOrder", st.FlattenOrder(InOrder), 0, n, false)
+	checkSequence(t, "PreOrder", st.FlattenOrder(PreOrder), 0, n, false)
+	checkSequence(t, "PostOrder", st.FlattenOrder(PostOrder), n-1, n, true)
+	if st.Ascend(intTest(n-1)) != intTest(n-1) || st.Count(intTest(n-2)) != 1 {
+		t.Error("unexpected retval")
+	}
+
+	var ca ComparableArray
+	st.AscendRange(intTest(n-3), intTest(n), collect(&ca, -1))
+	checkSequence(t, "AscendRange", ca, n-3, 3, false)
+	ca = ca[:0]
+	st.DescendLessThan(intTest(n-1), collect(&ca, 2))
+	checkSequence(t, "DescendLessThan", ca, n-2, 2, true)
+
+	it := st.Iterator()
+	if it.Last(); it.Value() != intTest(n-1) {
+		t.Error("Last: unexpected retval")
+	}
+	if it.Seek(intTest(n - 2)); it.Value() != intTest(n-2) {
+		t.Error("Seek: unexpected retval")
+	}
+
+	st.Insert(intTest(n))
+	if !st.Remove(intTest(n-1)) || !st.Remove(intTest(0)) || st.RemoveRange(intTest(1), intTest(3)) != 2 {
+		t.Error("unexpected retval")
+	}
+	ca = st.FlattenOrder(InOrder)
+	checkSequence(t, "Remove", ca[:len(ca)-1], 3, n-4, false)
+	if len(ca) != n-3 || ca[len(ca)-1] != intTest(n) {
+		t.Error("Insert: unexpected retval")
+	}
+
+	ft, err := NewFreeTree(st)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ft.Delete()
+
+	st.Delete()
+	if st.root.left != nil || st.root.right != nil {
+		t.Error("Delete: expected pointers to be reset")
+	}
+}
@@ -0,0 +1,252 @@
+// Copyright © 2015 Clement 'cmc' Rey <cr.rey.clement@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package freetree
+
+import (
+	"bytes"
+	"math"
+	"sort"
+	"unsafe"
+
+	"github.com/teh-cmc/mmm"
+)
+
+// -----------------------------------------------------------------------------
+
+// FreeStringTree implements a static, sorted set of strings with zero GC
+// overhead.
+//
+// The bytes of all the keys are copied, in increasing order, into a single
+// off-heap arena; a separate chunk holds the offset and length of every key,
+// which makes for an implicit, perfectly balanced, binary search tree.
+// Keys are compared using bytes.Compare, directly against the arena: lookups
+// never allocate.
+type FreeStringTree struct {
+	keyChunk chunk // extents of the keys, in increasing order
+	arena    chunk
+	closed   bool // whether Delete() has been called
+}
+
+// StringVisitor is called on every key visited during a range query.
+// Returning false stops the iteration.
+type StringVisitor func(key string) bool
+
+// NewFreeStringTree returns a new FreeStringTree holding `keys`, which don't
+// need to be sorted.
+//
+// Keys that appear several times in `keys` are kept.
+func NewFreeStringTree(keys []string) (*FreeStringTree, error) {
+	n := len(keys)
+	if n >= math.MaxUint32 {
+		return nil, ErrTooLarge
+	}
+	if n == 0 {
+		fst := &FreeStringTree{}
+		trackLeak(fst)
+		return fst, nil
+	}
+
+	sorted := append([]string(nil), keys...)
+	sort.Strings(sorted)
+	size := 0
+	for _, key := range sorted {
+		if len(key) > math.MaxUint32 {
+			return nil, ErrTooLarge
+		}
+		size += len(key)
+	}
+
+	keyChunk, err := mmm.NewMemChunk(extent{}, uint(n))
+	if err != nil {
+		return nil, err
+	}
+	fst := &FreeStringTree{keyChunk: newChunk(keyChunk, extent{}, n)}
+	if size > 0 {
+		pageSize := int(unsafe.Sizeof(arenaPage{}))
+		pages := (size + pageSize - 1) / pageSize
+		arenaChunk, err := mmm.NewMemChunk(arenaPage{}, uint(pages))
+		if err != nil {
+			fst.keyChunk.Delete()
+			return nil, err
+		}
+		fst.arena = newChunk(arenaChunk, arenaPage{}, pages)
+	}
+
+	var off uint64
+	for i, key := range sorted {
+		*fst.extent(i) = extent{off: off, len: uint32(len(key))}
+		copy(arenaBytes(fst.arena, off, len(key)), key)
+		off += uint64(len(key))
+	}
+	trackLeak(fst)
+
+	return fst, nil
+}
+
+// extent returns the extent of the i-th smallest key.
+func (fst FreeStringTree) extent(i int) *extent {
+	return (*extent)(unsafe.Pointer(fst.keyChunk.Pointer(i)))
+}
+
+// key returns the bytes of the i-th smallest key.
+//
+// The returned slice points to off-heap memory: it must not outlive the tree.
+func (fst FreeStringTree) key(i int) []byte {
+	e := fst.extent(i)
+	return arenaBytes(fst.arena, e.off, int(e.len))
+}
+
+// stringBytes returns the bytes of `s`, without copying them.
+//
+// The returned slice must not be modified.
+func stringBytes(s string) []byte {
+	return unsafe.Slice(unsafe.StringData(s), len(s))
+}
+
+// lowerBound returns the index of the smallest key that is >= `key`, or
+// Len() if there is none.
+func (fst FreeStringTree) lowerBound(key []byte) int {
+	lo, hi := 0, fst.keyChunk.len
+	for lo < hi {
+		mid := int(uint(lo+hi) >> 1)
+		if bytes.Compare(fst.key(mid), key) < 0 {
+			lo = mid + 1
+		} else {
+			hi = mid
+		}
+	}
+	return lo
+}
+
+// prefixEnd returns the index of the first key after `start` that doesn't
+// start with `prefix`, or Len() if there is none; the keys in [start, end)
+// all start with `prefix`.
+func (fst FreeStringTree) prefixEnd(start int, prefix []byte) int {
+	lo, hi := start, fst.keyChunk.len
+	for lo < hi {
+		mid := int(uint(lo+hi) >> 1)
+		if bytes.HasPrefix(fst.key(mid), prefix) {
+			lo = mid + 1
+		} else {
+			hi = mid
+		}
+	}
+	return lo
+}
+
+// Len returns the number of keys in the tree.
+func (fst FreeStringTree) Len() int {
+	fst.checkOpen()
+	return fst.keyChunk.len
+}
+
+// Contains returns true if the tree holds `key`.
+func (fst FreeStringTree) Contains(key string) bool {
+	fst.checkOpen()
+	k := stringBytes(key)
+	i := fst.lowerBound(k)
+	return i < fst.keyChunk.len && bytes.Equal(fst.key(i), k)
+}
+
+// Rank returns the number of keys in the tree that are < `key`.
+func (fst FreeStringTree) Rank(key string) int {
+	fst.checkOpen()
+	return fst.lowerBound(stringBytes(key))
+}
+
+// Select returns the k-th smallest key in the tree (starting at 0); the
+// boolean is false if `k` is out of bounds.
+func (fst FreeStringTree) Select(k int) (string, bool) {
+	fst.checkOpen()
+	if k < 0 || k >= fst.keyChunk.len {
+		return "", false
+	}
+	return string(fst.key(k)), true
+}
+
+// AscendPrefix calls `visitor` on every key of the tree that starts with
+// `prefix`, in increasing order.
+// Iteration stops as soon as `visitor` returns false.
+func (fst FreeStringTree) AscendPrefix(prefix string, visitor StringVisitor) {
+	fst.checkOpen()
+	p := stringBytes(prefix)
+	for i := fst.lowerBound(p); i < fst.keyChunk.len; i++ {
+		key := fst.key(i)
+		if !bytes.HasPrefix(key, p) || !visitor(string(key)) {
+			return
+		}
+	}
+}
+
+// CountPrefix returns the number of keys in the tree that start with
+// `prefix`.
+//
+// It runs in O(log(n)) and never allocates.
+func (fst FreeStringTree) CountPrefix(prefix string) int {
+	fst.checkOpen()
+	p := stringBytes(prefix)
+	start := fst.lowerBound(p)
+	return fst.prefixEnd(start, p) - start
+}
+
+// LongestCommonPrefix returns the longest prefix of `key` that is also a
+// prefix of at least one key of the tree.
+//
+// It runs in O(log(n)) and never allocates.
+func (fst FreeStringTree) LongestCommonPrefix(key string) string {
+	fst.checkOpen()
+	k := stringBytes(key)
+	// the keys sharing the longest prefix with `key` are always found around
+	// the place `key` would be inserted at
+	i := fst.lowerBound(k)
+	best := 0
+	if i > 0 {
+		best = commonPrefix(fst.key(i-1), k)
+	}
+	if i < fst.keyChunk.len {
+		if n := commonPrefix(fst.key(i), k); n > best {
+			best = n
+		}
+	}
+	return key[:best]
+}
+
+// commonPrefix returns the length of the longest common prefix of `a` and
+// `b`.
+func commonPrefix(a, b []byte) int {
+	n := 0
+	for n < len(a) && n < len(b) && a[n] == b[n] {
+		n++
+	}
+	return n
+}
+
+// Delete deletes the memory chunks associated with the tree.
+//
+// Deleting a tree twice is a no-op; any other use of a deleted tree panics
+// with ErrClosed.
+func (fst *FreeStringTree) Delete() *FreeStringTree {
+	if fst.closed {
+		return nil
+	}
+	fst.closed = true
+	fst.keyChunk.Delete()
+	fst.arena.Delete()
+
+	return nil
+}
+
+// deleted returns true if the tree has been deleted.
+func (fst *FreeStringTree) deleted() bool {
+	return fst.closed
+}
+
+// checkOpen panics with ErrClosed if the tree has been deleted.
+func (fst FreeStringTree) checkOpen() {
+	if fst.closed {
+		panic(ErrClosed)
+	}
+}
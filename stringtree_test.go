@@ -0,0 +1,128 @@
+// Copyright © 2015 Clement 'cmc' Rey <cr.rey.clement@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package freetree
+
+import (
+	"math/rand"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// -----------------------------------------------------------------------------
+
+func TestFreeStringTree(t *testing.T) {
+	r := rand.New(rand.NewSource(42))
+	keys := []string{"", "a", "a"} // empty and duplicate keys are kept
+	for i := 0; i < 2000; i++ {
+		b := make([]byte, r.Intn(8))
+		for j := range b {
+			b[j] = "abcd"[r.Intn(4)]
+		}
+		keys = append(keys, string(b))
+	}
+	fst, err := NewFreeStringTree(keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fst.Delete()
+	sorted := append([]string(nil), keys...)
+	sort.Strings(sorted)
+
+	if fst.Len() != len(sorted) {
+		t.Fatalf("unexpected length: %d", fst.Len())
+	}
+	for i, key := range sorted {
+		if k, ok := fst.Select(i); !ok || k != key {
+			t.Fatalf("Select(%d): unexpected retval: %q", i, k)
+		}
+	}
+	if _, ok := fst.Select(len(sorted)); ok {
+		t.Error("Select: expected out of bounds")
+	}
+
+	for _, query := range []string{"", "a", "ab", "abc", "dddd", "ddddddddd", "e", "bca", "cab", "z"} {
+		rank := sort.SearchStrings(sorted, query)
+		if fst.Rank(query) != rank {
+			t.Errorf("Rank(%q): unexpected retval: %d", query, fst.Rank(query))
+		}
+		if fst.Contains(query) != (rank < len(sorted) && sorted[rank] == query) {
+			t.Errorf("Contains(%q): unexpected retval", query)
+		}
+
+		var expected, visited []string
+		lcp := ""
+		for _, key := range sorted {
+			if strings.HasPrefix(key, query) {
+				expected = append(expected, key)
+			}
+			n := 0
+			for n < len(key) && n < len(query) && key[n] == query[n] {
+				n++
+			}
+			if n > len(lcp) {
+				lcp = query[:n]
+			}
+		}
+		fst.AscendPrefix(query, func(key string) bool {
+			visited = append(visited, key)
+			return true
+		})
+		if strings.Join(visited, ",") != strings.Join(expected, ",") {
+			t.Errorf("AscendPrefix(%q): expected %v, got %v", query, expected, visited)
+		}
+		if fst.CountPrefix(query) != len(expected) {
+			t.Errorf("CountPrefix(%q): unexpected retval: %d", query, fst.CountPrefix(query))
+		}
+		if fst.LongestCommonPrefix(query) != lcp {
+			t.Errorf("LongestCommonPrefix(%q): expected %q, got %q", query, lcp, fst.LongestCommonPrefix(query))
+		}
+	}
+
+	visited := 0
+	fst.AscendPrefix("a", func(string) bool {
+		visited++
+		return visited < 3
+	})
+	if visited != 3 {
+		t.Error("expected iteration to stop")
+	}
+}
+
+func TestFreeStringTree_allocs(t *testing.T) {
+	fst, err := NewFreeStringTree([]string{"foo", "foobar", "bar", "baz", "qux"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fst.Delete()
+
+	query := strings.Repeat("foo", 20) // too long to be copied on the stack
+	allocs := testing.AllocsPerRun(100, func() {
+		fst.Contains(query)
+		fst.Rank(query)
+		fst.CountPrefix("ba")
+		fst.LongestCommonPrefix(query)
+	})
+	if allocs != 0 {
+		t.Errorf("unexpected allocations: %v", allocs)
+	}
+}
+
+func TestFreeStringTree_empty(t *testing.T) {
+	for _, keys := range [][]string{nil, {"", ""}} {
+		fst, err := NewFreeStringTree(keys)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fst.Len() != len(keys) || fst.Contains("a") || fst.CountPrefix("") != len(keys) ||
+			fst.LongestCommonPrefix("abc") != "" {
+			t.Errorf("%q: unexpected retval", keys)
+		}
+		fst.Delete()
+		fst.Delete() // no-op
+		checkClosed(t, "Len", func() { fst.Len() })
+	}
+}
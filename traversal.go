@@ -0,0 +1,50 @@
+// Copyright © 2015 Clement 'cmc' Rey <cr.rey.clement@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package freetree
+
+import "fmt"
+
+// -----------------------------------------------------------------------------
+
+// TraversalOrder defines the order in which the nodes of a tree are visited.
+type TraversalOrder int
+
+const (
+	// PostOrder visits the left subtree, then the right subtree, then the
+	// node itself.
+	// This is the default order used by Flatten().
+	PostOrder TraversalOrder = iota
+	// InOrder visits the left subtree, then the node itself, then the right
+	// subtree; i.e. elements are visited in increasing order.
+	InOrder
+	// PreOrder visits the node itself, then the left subtree, then the right
+	// subtree.
+	PreOrder
+	// LevelOrder visits the tree breadth-first, one level at a time, from
+	// left to right.
+	LevelOrder
+)
+
+// String returns the name of the traversal order.
+func (o TraversalOrder) String() string {
+	switch o {
+	case PostOrder:
+		return "PostOrder"
+	case InOrder:
+		return "InOrder"
+	case PreOrder:
+		return "PreOrder"
+	case LevelOrder:
+		return "LevelOrder"
+	}
+	return fmt.Sprintf("TraversalOrder(%d)", int(o))
+}
+
+// -----------------------------------------------------------------------------
+
+// Visitor is called on every element visited during a range query.
+// Returning false stops the iteration.
+type Visitor func(c Comparable) bool